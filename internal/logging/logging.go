@@ -0,0 +1,127 @@
+// Package logging writes the logs of the worker and the server as one JSON
+// object per line, eg: {"time":"...","level":"info","msg":"fetched videos",
+// "search_key":"cats","count":12}, unless LOG_FORMAT=text keeps them human
+// readable.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	mu         sync.Mutex
+	out        io.Writer = os.Stderr
+	jsonFormat bool
+)
+
+// Setup picks the format from LOG_FORMAT, and makes the standard logger write
+// JSON too when it's not text. Lines logged with the standard logger get their
+// level from their "Error: " or "Warning: " prefix.
+func Setup() {
+	if os.Getenv("LOG_FORMAT") == "text" {
+		return
+	}
+	jsonFormat = true
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{})
+}
+
+// stdWriter turns the lines of the standard logger into JSON.
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	level := "info"
+	if rest := strings.TrimPrefix(msg, "Error: "); rest != msg {
+		level, msg = "error", rest
+	} else if rest := strings.TrimPrefix(msg, "Warning: "); rest != msg {
+		level, msg = "warn", rest
+	}
+	write(level, msg, nil)
+	return len(p), nil
+}
+
+// Info logs msg with fields, alternating keys and values like
+// logging.Info("fetched videos", "search_key", term, "count", n).
+func Info(msg string, fields ...interface{}) { logFields("info", msg, fields) }
+
+// Warn logs msg with fields at the warn level, see Info.
+func Warn(msg string, fields ...interface{}) { logFields("warn", msg, fields) }
+
+// Error logs msg with fields at the error level, see Info.
+func Error(msg string, fields ...interface{}) { logFields("error", msg, fields) }
+
+func logFields(level, msg string, fields []interface{}) {
+	if jsonFormat {
+		write(level, msg, fields)
+		return
+	}
+	var b strings.Builder
+	switch level {
+	case "error":
+		b.WriteString("Error: ")
+	case "warn":
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", fields[i], value(fields, i+1))
+	}
+	log.Print(b.String())
+}
+
+// value returns the value of the field whose key is at i-1, or a marker when
+// fields has an odd length.
+func value(fields []interface{}, i int) interface{} {
+	if i >= len(fields) {
+		return "!MISSING"
+	}
+	switch v := fields[i].(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fields[i]
+}
+
+// write outputs a JSON line with time, level and msg first, then fields in
+// the order they're given.
+func write(level, msg string, fields []interface{}) {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	appendJSON(&b, time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	appendJSON(&b, level)
+	b.WriteString(`,"msg":`)
+	appendJSON(&b, msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(',')
+		appendJSON(&b, fmt.Sprint(fields[i]))
+		b.WriteByte(':')
+		appendJSON(&b, value(fields, i+1))
+	}
+	b.WriteString("}\n")
+
+	mu.Lock()
+	defer mu.Unlock()
+	out.Write(b.Bytes())
+}
+
+func appendJSON(b *bytes.Buffer, v interface{}) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(encoded)
+}
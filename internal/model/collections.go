@@ -0,0 +1,76 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// MaxCollectionNameLength is the longest keyword collection name in bytes.
+const MaxCollectionNameLength = 120
+
+// StateCollection is where the worker keeps how far each search term has been
+// collected, so a restarted worker carries on from there, and how it polls it.
+// The server lists it on /status, eg: {_id: "cats", lastFetchedTime: ...,
+// pollInterval: 300}
+const StateCollection = "_state"
+
+// AliasesCollection maps alternative names of keywords to their collection,
+// eg: {_id: "golang", collection: "go programming"}
+const AliasesCollection = "_aliases"
+
+// CollectionSet is a set of collection names, safe for concurrent use.
+type CollectionSet struct {
+	mu    sync.RWMutex
+	names map[string]struct{}
+}
+
+// Contains reports whether name is in the set.
+func (c *CollectionSet) Contains(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.names[name]
+	return ok
+}
+
+// Replace makes names the content of the set.
+func (c *CollectionSet) Replace(names []string) {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.names = set
+}
+
+// IsInternalCollection reports whether name is a collection the worker or
+// mongo keeps for itself, like _metrics or system.views, rather than the
+// videos of a keyword.
+func IsInternalCollection(name string) bool {
+	return strings.HasPrefix(name, "_") || strings.HasPrefix(name, "system.")
+}
+
+// ValidateCollectionName returns the collection the videos of keyword are
+// stored in: keyword lowercased, trimmed and with runs of whitespace turned
+// into single spaces, so "Cats" and " cats " share one collection. It fails
+// for keywords mongo can't name a collection after, or that would clash with
+// an internal collection.
+func ValidateCollectionName(keyword string) (string, error) {
+	name := strings.ToLower(strings.Join(strings.Fields(keyword), " "))
+	switch {
+	case name == "":
+		return "", errors.New("keyword is empty")
+	case !utf8.ValidString(name):
+		return "", errors.New("keyword isn't valid UTF-8")
+	case strings.ContainsAny(name, "$\x00"):
+		return "", errors.New("keyword can't contain $ or null characters")
+	case IsInternalCollection(name):
+		return "", errors.New("keyword can't start with _ or system.")
+	case len(name) > MaxCollectionNameLength:
+		return "", fmt.Errorf("keyword can't be longer than %d bytes", MaxCollectionNameLength)
+	}
+	return name, nil
+}
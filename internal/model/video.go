@@ -0,0 +1,135 @@
+// Package model holds the types and helpers the worker and the server share,
+// so what one stores is what the other reads.
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var youtubeIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// IsYoutubeID reports whether id has the shape of a youtube video id, the
+// ones a watch url can be made of.
+func IsYoutubeID(id string) bool {
+	return youtubeIDRegex.MatchString(id)
+}
+
+// Video is a search result as stored in a keyword collection.
+type Video struct {
+	ID           primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	YoutubeID    string             `json:"youtubeId,omitempty" bson:"youtubeId,omitempty"`
+	Title        string             `json:"title,omitempty" bson:"title,omitempty"`
+	Description  string             `json:"description,omitempty" bson:"description,omitempty"`
+	PublishedAt  time.Time          `json:"publishedAt,omitempty" bson:"publishedAt,omitempty"`
+	ThumbnailUrl string             `json:"thumbnailUrl,omitempty" bson:"thumbnailUrl,omitempty"`
+	ChannelID    string             `json:"channelId,omitempty" bson:"channelId,omitempty"`
+	// Every size youtube has. ThumbnailUrl stays set to the default one for older clients
+	Thumbnails *Thumbnails `json:"thumbnails,omitempty" bson:"thumbnails,omitempty"`
+	// INSTANCE_NAME of the worker that collected the video
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+	// REGION_CODE of the worker that collected the video, empty for worldwide results
+	RegionCode string `json:"regionCode,omitempty" bson:"regionCode,omitempty"`
+	// live, upcoming or none, when the video was last fetched
+	LiveBroadcastContent string `json:"liveBroadcastContent,omitempty" bson:"liveBroadcastContent,omitempty"`
+
+	// Statistics when the video was last fetched, zero when hidden by the channel
+	ViewCount    int64 `json:"viewCount,omitempty" bson:"viewCount,omitempty"`
+	LikeCount    int64 `json:"likeCount,omitempty" bson:"likeCount,omitempty"`
+	CommentCount int64 `json:"commentCount,omitempty" bson:"commentCount,omitempty"`
+	// Whether the statistics were fetched at all, so hidden ones can be told
+	// apart from ones that failed to be fetched
+	Enriched bool `json:"-" bson:"enriched,omitempty"`
+
+	// When a worker first stored the video. Later sightings only refresh its
+	// title, description, thumbnails and statistics
+	FirstSeenAt *time.Time `json:"firstSeenAt,omitempty" bson:"firstSeenAt,omitempty"`
+
+	// Poll window the video was collected in, only stored when TRACE_WINDOWS=true
+	FetchWindowStart *time.Time `json:"fetchWindowStart,omitempty" bson:"fetchWindowStart,omitempty"`
+	FetchWindowEnd   *time.Time `json:"fetchWindowEnd,omitempty" bson:"fetchWindowEnd,omitempty"`
+
+	// How the video was last fetched, only stored when RECORD_FETCH_TIMING=true
+	FetchTiming *FetchTiming `json:"-" bson:"fetchTiming,omitempty"`
+
+	// Gzipped description, stored instead of Description when COMPRESS_DESCRIPTIONS=true
+	DescriptionGzip       []byte `json:"-" bson:"descriptionGzip,omitempty"`
+	DescriptionCompressed bool   `json:"-" bson:"descriptionCompressed,omitempty"`
+}
+
+// FetchTiming profiles the fetch of a video, from the search returning it to
+// it being stored.
+type FetchTiming struct {
+	SeenAt time.Time `bson:"seenAt"`
+	// From SeenAt until the video was written
+	LatencyMs int64 `bson:"latencyMs"`
+	// Whether its statistics took a videos.list round trip, and how long that took
+	Enriched     bool  `bson:"enriched"`
+	EnrichmentMs int64 `bson:"enrichmentMs,omitempty"`
+}
+
+// FetchTimingStats aggregates the FetchTiming of the videos of a save. The
+// worker keeps the last one of each search term in its state.
+type FetchTimingStats struct {
+	Videos       int   `json:"videos" bson:"videos"`
+	AvgLatencyMs int64 `json:"avgLatencyMs" bson:"avgLatencyMs"`
+	MaxLatencyMs int64 `json:"maxLatencyMs" bson:"maxLatencyMs"`
+	// Videos whose statistics took a round trip, and how long it took them on average
+	EnrichedVideos  int       `json:"enrichedVideos" bson:"enrichedVideos"`
+	AvgEnrichmentMs int64     `json:"avgEnrichmentMs" bson:"avgEnrichmentMs"`
+	RecordedAt      time.Time `json:"recordedAt" bson:"recordedAt"`
+}
+
+// Thumbnails are the sizes of a video's thumbnail, any of them can be missing.
+type Thumbnails struct {
+	Default  *Thumbnail `json:"default,omitempty" bson:"default,omitempty"`
+	Medium   *Thumbnail `json:"medium,omitempty" bson:"medium,omitempty"`
+	High     *Thumbnail `json:"high,omitempty" bson:"high,omitempty"`
+	Standard *Thumbnail `json:"standard,omitempty" bson:"standard,omitempty"`
+	Maxres   *Thumbnail `json:"maxres,omitempty" bson:"maxres,omitempty"`
+}
+
+type Thumbnail struct {
+	Url    string `json:"url" bson:"url"`
+	Width  int64  `json:"width,omitempty" bson:"width,omitempty"`
+	Height int64  `json:"height,omitempty" bson:"height,omitempty"`
+}
+
+// CompressDescription moves Description into DescriptionGzip.
+func (v *Video) CompressDescription() error {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(v.Description)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	v.DescriptionGzip = b.Bytes()
+	v.DescriptionCompressed = true
+	v.Description = ""
+	return nil
+}
+
+// DecompressDescription restores Description for videos stored compressed.
+func (v *Video) DecompressDescription() error {
+	if !v.DescriptionCompressed {
+		return nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(v.DescriptionGzip))
+	if err != nil {
+		return err
+	}
+	description, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	v.Description = string(description)
+	v.DescriptionGzip = nil
+	return nil
+}
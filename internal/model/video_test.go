@@ -0,0 +1,73 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDescriptionCompressionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+	}{
+		{"empty", ""},
+		{"short", "cats"},
+		{"unicode", "猫のビデオ 🐈"},
+		{"long", strings.Repeat("A day in the life of a cat. ", 500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Video{YoutubeID: "dQw4w9WgXcQ", Description: tt.description}
+			if err := v.CompressDescription(); err != nil {
+				t.Fatal(err)
+			}
+			if v.Description != "" || !v.DescriptionCompressed {
+				t.Fatalf("compressed video keeps a plain description: %+v", v)
+			}
+			if len(tt.description) > 1000 && len(v.DescriptionGzip) >= len(tt.description) {
+				t.Errorf("compressed to %d bytes from %d", len(v.DescriptionGzip), len(tt.description))
+			}
+
+			// As stored and read back
+			doc, err := bson.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stored Video
+			if err := bson.Unmarshal(doc, &stored); err != nil {
+				t.Fatal(err)
+			}
+			if err := stored.DecompressDescription(); err != nil {
+				t.Fatal(err)
+			}
+			if stored.Description != tt.description || stored.DescriptionGzip != nil {
+				t.Errorf("decompressed to %q, want %q", stored.Description, tt.description)
+			}
+		})
+	}
+}
+
+func TestDecompressDescription(t *testing.T) {
+	tests := []struct {
+		name    string
+		video   Video
+		want    string
+		wantErr bool
+	}{
+		{"stored uncompressed", Video{Description: "cats"}, "cats", false},
+		{"corrupt", Video{DescriptionCompressed: true, DescriptionGzip: []byte("not gzip")}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.video.DecompressDescription()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecompressDescription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.video.Description != tt.want {
+				t.Errorf("description = %q, want %q", tt.video.Description, tt.want)
+			}
+		})
+	}
+}
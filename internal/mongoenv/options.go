@@ -0,0 +1,50 @@
+// Package mongoenv configures mongo clients from env variables shared by the
+// worker and the server.
+package mongoenv
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ClientOptions returns the options connecting to uri, with the pool size and
+// timeouts set by env variables. Unset ones keep the uri's value, or the
+// driver's default: a pool of 0 to 100 connections and 30s timeouts.
+//
+//   - MONGO_MAX_POOL_SIZE, MONGO_MIN_POOL_SIZE: connections kept per server
+//   - MONGO_CONNECT_TIMEOUT: seconds opening a connection can take
+//   - MONGO_SERVER_SELECTION_TIMEOUT: seconds to wait for a suitable server
+func ClientOptions(uri string) *options.ClientOptions {
+	opts := options.Client().ApplyURI(uri)
+	if n, ok := envUint("MONGO_MAX_POOL_SIZE"); ok {
+		opts.SetMaxPoolSize(n)
+	}
+	if n, ok := envUint("MONGO_MIN_POOL_SIZE"); ok {
+		opts.SetMinPoolSize(n)
+	}
+	if n, ok := envUint("MONGO_CONNECT_TIMEOUT"); ok {
+		opts.SetConnectTimeout(time.Duration(n) * time.Second)
+	}
+	if n, ok := envUint("MONGO_SERVER_SELECTION_TIMEOUT"); ok {
+		opts.SetServerSelectionTimeout(time.Duration(n) * time.Second)
+	}
+	return opts
+}
+
+// envUint reads the env variable name as a number, logging invalid values.
+func envUint(name string) (uint64, bool) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		log.Printf("%s must be a positive number. Ignoring %s", name, value)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,25 @@
+package mongoenv
+
+import (
+	"log"
+	"os"
+)
+
+// SharedCollection holds the videos of every keyword with STORAGE_MODE=shared,
+// each tagged with the keywords it was found for. It's internal so it doesn't
+// list as a keyword of its own.
+const SharedCollection = "_videos"
+
+// SharedStorage reports whether STORAGE_MODE=shared stores all videos in
+// SharedCollection, instead of a collection per keyword.
+func SharedStorage() bool {
+	switch mode := os.Getenv("STORAGE_MODE"); mode {
+	case "", "collection":
+		return false
+	case "shared":
+		return true
+	default:
+		log.Printf("STORAGE_MODE must be collection or shared, got %q. Defaulting to collection", mode)
+		return false
+	}
+}
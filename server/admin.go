@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminToken is the bearer token admin endpoints require. They're disabled
+// when it isn't set.
+var adminToken string
+
+var unauthorizedError = Error{http.StatusUnauthorized, "Unauthorized"}
+
+func isAdmin(r *http.Request) bool {
+	if adminToken == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// requireAdmin only lets requests with the admin token through to handler.
+func requireAdmin(handler keywordHandler) keywordHandler {
+	return func(w http.ResponseWriter, r *http.Request, keyword string) {
+		if !isAdmin(r) {
+			unauthorizedError.writeHttpResponse(w)
+			return
+		}
+		handler(w, r, keyword)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// resolveAlias returns the collection alias points to, or "" if it isn't one.
+func resolveAlias(ctx context.Context, alias string) (string, *Error) {
+	var doc struct {
+		Collection string `bson:"collection"`
+	}
+	err := database.Collection(model.AliasesCollection).FindOne(ctx, bson.D{{Key: "_id", Value: alias}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("Error: cannot resolve alias %s: %v", alias, err)
+		return "", &internalError
+	}
+	return doc.Collection, nil
+}
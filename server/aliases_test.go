@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestValidateKeywordAlias(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	collections := func(names ...string) bson.D {
+		var docs []bson.D
+		for _, name := range names {
+			docs = append(docs, bson.D{{Key: "name", Value: name}})
+		}
+		return mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch, docs...)
+	}
+	aliases := func(docs ...bson.D) bson.D {
+		return mtest.CreateCursorResponse(0, "test._aliases", mtest.FirstBatch, docs...)
+	}
+	tests := []struct {
+		name       string
+		keyword    string
+		responses  []bson.D
+		want       string
+		wantStatus int
+	}{
+		{
+			name:      "keyword is a collection",
+			keyword:   "go programming",
+			responses: []bson.D{collections("go programming")},
+			want:      "go programming",
+		},
+		{
+			name:      "alias resolves to its collection",
+			keyword:   "golang",
+			responses: []bson.D{collections(), aliases(bson.D{{Key: "_id", Value: "golang"}, {Key: "collection", Value: "go programming"}}), collections("go programming")},
+			want:      "go programming",
+		},
+		{
+			name:       "alias to a missing collection",
+			keyword:    "golang",
+			responses:  []bson.D{collections(), aliases(bson.D{{Key: "_id", Value: "golang"}, {Key: "collection", Value: "go programming"}}), collections()},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "neither a collection nor an alias",
+			keyword:    "fish",
+			responses:  []bson.D{collections(), aliases()},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "alias lookup fails",
+			keyword:    "golang",
+			responses:  []bson.D{collections(), mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "unauthorized"})},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(10)
+			mt.AddMockResponses(tt.responses...)
+
+			got, err := validateKeyword(context.Background(), tt.keyword)
+			if tt.wantStatus != 0 {
+				if err == nil || err.Code != tt.wantStatus {
+					mt.Fatalf("validateKeyword(%q) error = %v, want status %d", tt.keyword, err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if got != tt.want {
+				mt.Errorf("validateKeyword(%q) = %q, want %q", tt.keyword, got, tt.want)
+			}
+			if tt.keyword != tt.want && existingCollections.contains(tt.keyword) {
+				mt.Errorf("the alias %q was cached as a collection", tt.keyword)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultAtlasSearchIndex = "default"
+	defaultAtlasMaxEdits    = 2
+)
+
+var (
+	// atlasSearch runs searches with the Atlas Search $search stage instead of
+	// $text, when SEARCH_BACKEND=atlas
+	atlasSearch      bool
+	atlasSearchIndex = defaultAtlasSearchIndex
+	// atlasMaxEdits is how many typos a searched word can have, 1 or 2
+	atlasMaxEdits = defaultAtlasMaxEdits
+	// atlasUnavailable is set once mongo rejected a $search stage, so
+	// searches stick to $text from then on
+	atlasUnavailable atomic.Bool
+)
+
+// useAtlasSearch reports whether the search param is run with Atlas Search.
+func useAtlasSearch(q url.Values) bool {
+	return atlasSearch && q.Get("search") != "" && !atlasUnavailable.Load()
+}
+
+// isSearchUnsupported reports whether err is mongo not knowing the $search
+// stage, as it's only available on Atlas.
+func isSearchUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	// Unrecognized pipeline stage, and $search only being allowed on Atlas
+	return cmdErr.Code == 40324 || cmdErr.Code == 6047401 || strings.Contains(cmdErr.Message, "$search")
+}
+
+// fallBackToText stops using Atlas Search after mongo rejected it with err.
+func fallBackToText(err error) {
+	if atlasUnavailable.CompareAndSwap(false, true) {
+		log.Printf("Warning: Atlas Search isn't available, falling back to $text search: %v", err)
+	}
+}
+
+// withoutTextSearch returns filter without its $text condition, which
+// $search replaces.
+func withoutTextSearch(filter bson.D) bson.D {
+	withoutText := bson.D{}
+	for _, e := range filter {
+		if e.Key != "$text" {
+			withoutText = append(withoutText, e)
+		}
+	}
+	return withoutText
+}
+
+// atlasSearchStages finds the videos fuzzily matching search in their title or
+// description that also match filter, with $text left out of it.
+func atlasSearchStages(search string, filter bson.D) mongo.Pipeline {
+	pipeline := mongo.Pipeline{
+		{{Key: "$search", Value: bson.D{
+			{Key: "index", Value: atlasSearchIndex},
+			{Key: "text", Value: bson.D{
+				{Key: "query", Value: search},
+				{Key: "path", Value: bson.A{"title", "description"}},
+				{Key: "fuzzy", Value: bson.D{{Key: "maxEdits", Value: atlasMaxEdits}}},
+			}},
+		}}},
+	}
+	if filter = withoutTextSearch(filter); len(filter) != 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+	return pipeline
+}
+
+// atlasSearchPipeline is the Atlas Search equivalent of finding the videos
+// matching filter, with their searchScore as score. sortOrder's $meta score is
+// replaced by that score.
+func atlasSearchPipeline(search string, filter, sortOrder bson.D, skip, limit int) mongo.Pipeline {
+	sortByScore := bson.D{}
+	for _, e := range sortOrder {
+		if e.Key == "score" {
+			e.Value = -1
+		}
+		sortByScore = append(sortByScore, e)
+	}
+	return append(atlasSearchStages(search, filter),
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "searchScore"}}}}}},
+		bson.D{{Key: "$sort", Value: sortByScore}},
+		bson.D{{Key: "$skip", Value: skip}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+}
+
+// countVideos counts the videos of collection matching filter, with Atlas
+// Search when it runs the request's search.
+func countVideos(ctx context.Context, collection *mongo.Collection, q url.Values, filter bson.D) (int64, error) {
+	if useAtlasSearch(q) {
+		pipeline := append(atlasSearchStages(q.Get("search"), filter), bson.D{{Key: "$count", Value: "total"}})
+		cursor, err := collection.Aggregate(ctx, pipeline)
+		if err == nil {
+			defer cursor.Close(ctx)
+			var result struct {
+				Total int64 `bson:"total"`
+			}
+			if cursor.Next(ctx) {
+				err = cursor.Decode(&result)
+			} else {
+				err = cursor.Err()
+			}
+			return result.Total, err
+		}
+		if !isSearchUnsupported(err) {
+			return 0, err
+		}
+		fallBackToText(err)
+	}
+	return collection.CountDocuments(ctx, filter)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+const defaultMaxCachedCollections = 1000
+
+// collectionCache remembers up to max collection names known to exist,
+// evicting the least recently used ones.
+type collectionCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // of string, most recently used first
+	items map[string]*list.Element
+}
+
+func newCollectionCache(max int) *collectionCache {
+	return &collectionCache{
+		max:   max,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// contains reports whether name is cached, marking it as recently used.
+func (c *collectionCache) contains(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[name]
+	if ok {
+		c.order.MoveToFront(e)
+	}
+	return ok
+}
+
+func (c *collectionCache) add(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[name]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[name] = c.order.PushFront(name)
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(string))
+	}
+}
+
+// remove forgets name, eg: once its collection is dropped.
+func (c *collectionCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[name]; ok {
+		c.order.Remove(e)
+		delete(c.items, name)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCollectionCacheConcurrentAccess(t *testing.T) {
+	c := newCollectionCache(8)
+	c.add("cats")
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "term" + strconv.Itoa(i%10)
+			for j := 0; j < 200; j++ {
+				c.add(name)
+				c.contains(name)
+				c.contains("unknown")
+				if j%7 == 0 {
+					c.remove(name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := c.order.Len(); n > 8 || n != len(c.items) {
+		t.Errorf("cache holds %d names and %d items, want at most 8 of each", n, len(c.items))
+	}
+}
+
+// Run with -race: validateKeyword is called by every request goroutine
+func TestValidateKeywordConcurrentRequests(t *testing.T) {
+	unreachableDatabase(t)
+	saved := existingCollections
+	defer func() { existingCollections = saved }()
+	existingCollections = newCollectionCache(defaultMaxCachedCollections)
+	existingCollections.add("cats")
+	existingCollections.add("golang")
+
+	tests := []struct {
+		keyword string
+		want    string
+		wantErr bool
+	}{
+		{"cats", "cats", false},
+		{"golang", "golang", false},
+		{"", "", true},
+		{"bad$name", "", true},
+		// Looked up in the db, which is unreachable
+		{"unknown", "", true},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, tt := range tests {
+			wg.Add(1)
+			go func(keyword, want string, wantErr bool) {
+				defer wg.Done()
+				got, err := validateKeyword(context.Background(), keyword)
+				if (err != nil) != wantErr || got != want {
+					t.Errorf("validateKeyword(%q) = %q, %v", keyword, got, err)
+				}
+			}(tt.keyword, tt.want, tt.wantErr)
+		}
+		// Keywords being listed or dropped meanwhile
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "listed" + strconv.Itoa(i)
+			existingCollections.add(name)
+			existingCollections.remove(name)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCollectionCacheEviction(t *testing.T) {
+	c := newCollectionCache(2)
+	c.add("cats")
+	c.add("dogs")
+	// Using cats makes dogs the least recently used
+	c.contains("cats")
+	c.add("birds")
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"cats", true},
+		{"dogs", false},
+		{"birds", true},
+	}
+	for _, tt := range tests {
+		if got := c.contains(tt.name); got != tt.want {
+			t.Errorf("contains(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	c.remove("cats")
+	if c.contains("cats") || c.order.Len() != 1 {
+		t.Errorf("cats still cached after remove, %d cached", c.order.Len())
+	}
+}
+
+func TestValidateKeywordAfterEviction(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("evicted keyword checked again", func(mt *mtest.T) {
+		savedDB, savedCollections := database, existingCollections
+		defer func() { database, existingCollections = savedDB, savedCollections }()
+		database = mt.DB
+		existingCollections = newCollectionCache(1)
+		existingCollections.add("cats")
+		existingCollections.add("dogs")
+
+		// cats was evicted, so it's looked up and cached again
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch, bson.D{{Key: "name", Value: "cats"}}))
+		if got, err := validateKeyword(context.Background(), "cats"); err != nil || got != "cats" {
+			mt.Fatalf("validateKeyword(cats) = %q, %v", got, err)
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 1 {
+			mt.Errorf("ran %d commands, want the one lookup", n)
+		}
+		if !existingCollections.contains("cats") || existingCollections.contains("dogs") {
+			mt.Error("cats should have replaced dogs in the cache")
+		}
+		mt.ClearEvents()
+		if got, err := validateKeyword(context.Background(), "cats"); err != nil || got != "cats" {
+			mt.Fatalf("validateKeyword(cats) = %q, %v", got, err)
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			mt.Errorf("ran %d commands for a cached keyword", n)
+		}
+
+		// Neither a collection nor an alias
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test._aliases", mtest.FirstBatch),
+		)
+		if _, err := validateKeyword(context.Background(), "fish"); err == nil || err.Code != http.StatusBadRequest {
+			mt.Errorf("validateKeyword(fish) error = %v, want 400", err)
+		}
+	})
+}
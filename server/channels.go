@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"example.com/hello/internal/model"
+	"example.com/hello/internal/mongoenv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxChannelCollections bounds how many keyword collections a channel feed scans.
+const maxChannelCollections = 50
+
+// keywordCollections returns the names of all keyword collections, leaving
+// out internal ones. With STORAGE_MODE=shared it's the shared collection's
+// keywords.
+func keywordCollections(ctx context.Context) ([]string, error) {
+	if sharedStorage {
+		return storedKeywords(ctx)
+	}
+	collections, err := database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	var keywords []string
+	for _, c := range collections {
+		if model.IsInternalCollection(c) {
+			continue
+		}
+		keywords = append(keywords, c)
+	}
+	return keywords, nil
+}
+
+// getChannelVideos serves GET /channels/{channelId}/videos: the channel's
+// videos collected under any keyword.
+func getChannelVideos(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path[len("/channels/"):]
+	channelID := strings.TrimSuffix(path, "/videos")
+	if channelID == path || channelID == "" || strings.Contains(channelID, "/") {
+		notFoundError.writeHttpResponse(w)
+		return
+	}
+
+	filter, filterErr := videosFilter(r.URL.Query())
+	if filterErr != nil {
+		filterErr.writeHttpResponse(w)
+		return
+	}
+	filter = append(filter, bson.E{Key: "channelId", Value: channelID})
+	// The shared collection has every keyword's videos, once each
+	if sharedStorage {
+		writeSharedVideos(w, r, filter)
+		return
+	}
+
+	keywords, err := keywordCollections(r.Context())
+	if err != nil {
+		log.Println("Error: Unable to get list of collections")
+		internalError.writeHttpResponse(w)
+		return
+	}
+	if len(keywords) > maxChannelCollections {
+		log.Printf("Channel feed only scans %d of %d collections", maxChannelCollections, len(keywords))
+		keywords = keywords[:maxChannelCollections]
+	}
+	writeMergedVideos(w, r, keywords, filter)
+}
+
+// writeSharedVideos responds with a page of the videos matching filter in the
+// shared collection, newest first, each with the keyword that first found it.
+func writeSharedVideos(w http.ResponseWriter, r *http.Request, filter bson.D) {
+	q := r.URL.Query()
+	page, limit := parsePagination(q)
+	findOptions := options.Find().
+		SetSkip(int64(page * limit)).
+		SetLimit(int64(limit + 1)).
+		SetSort(bson.D{{Key: "publishedAt", Value: -1}})
+	if q.Get("search") != "" {
+		findOptions.SetProjection(scoreProjection)
+	}
+	cursor, err := database.Collection(mongoenv.SharedCollection).Find(r.Context(), filter, findOptions)
+	if err != nil {
+		log.Printf("Error: cannot get videos: %v", err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	var videos []keywordVideo
+	for cursor.Next(r.Context()) {
+		video, err := decodeVideo(cursor)
+		if err != nil {
+			log.Println("Error: failed to decode result")
+			continue
+		}
+		v := keywordVideo{Video: video}
+		if keywords, ok := cursor.Current.Lookup("keywords").ArrayOK(); ok {
+			if values, err := keywords.Values(); err == nil && len(values) != 0 {
+				v.Keyword, _ = values[0].StringValueOK()
+			}
+		}
+		if err := v.DecompressDescription(); err != nil {
+			log.Printf("Error: failed to decompress description of %s: %v", v.YoutubeID, err)
+		}
+		videos = append(videos, v)
+	}
+	hasNext := len(videos) > limit
+	if hasNext {
+		videos = videos[:limit]
+	}
+	writeKeywordVideos(w, r, page, limit, videos, hasNext)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetChannelVideosAcrossKeywords(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	video := func(id string, hours int) bson.D {
+		return bson.D{
+			{Key: "youtubeId", Value: id},
+			{Key: "channelId", Value: "UCchannel"},
+			{Key: "publishedAt", Value: time.Date(2024, 5, 1, hours, 0, 0, 0, time.UTC)},
+		}
+	}
+	mt.Run("merged", func(mt *mtest.T) {
+		saved := database
+		defer func() { database = saved }()
+		database = mt.DB
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch,
+				bson.D{{Key: "name", Value: "cats"}}, bson.D{{Key: "name", Value: "_state"}}, bson.D{{Key: "name", Value: "pets"}}),
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, video("catvideo001", 9), video("sharedvideo", 5)),
+			mtest.CreateCursorResponse(0, "test.pets", mtest.FirstBatch, video("petvideo001", 7), video("sharedvideo", 5)),
+		)
+		r := httptest.NewRequest(http.MethodGet, "/channels/UCchannel/videos", nil)
+		w := httptest.NewRecorder()
+		getChannelVideos(w, r)
+		if w.Code != http.StatusOK {
+			mt.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+
+		var queried []string
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName != "find" {
+				continue
+			}
+			queried = append(queried, e.Command.Lookup("find").StringValue())
+			if got := e.Command.Lookup("filter", "channelId").StringValue(); got != "UCchannel" {
+				mt.Errorf("find on %s filtered by channel %q", e.Command.Lookup("find"), got)
+			}
+		}
+		if want := []string{"cats", "pets"}; !reflect.DeepEqual(queried, want) {
+			mt.Errorf("queried %v, want %v", queried, want)
+		}
+
+		var response struct {
+			Result []struct {
+				YoutubeID string `json:"youtubeId"`
+				Keyword   string `json:"keyword"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			mt.Fatal(err)
+		}
+		var got []string
+		for _, v := range response.Result {
+			got = append(got, v.Keyword+"/"+v.YoutubeID)
+		}
+		if want := []string{"cats/catvideo001", "pets/petvideo001", "cats/sharedvideo"}; !reflect.DeepEqual(got, want) {
+			mt.Errorf("result %v, want %v", got, want)
+		}
+	})
+}
+
+func TestGetChannelVideosPath(t *testing.T) {
+	for _, path := range []string{"/channels/UCchannel", "/channels//videos", "/channels/a/b/videos"} {
+		w := httptest.NewRecorder()
+		getChannelVideos(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestGetChannelVideosSharedStorage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	defer func(shared bool) { sharedStorage = shared }(sharedStorage)
+
+	video := func(id string, hours int, keywords ...string) bson.D {
+		return bson.D{
+			{Key: "youtubeId", Value: id},
+			{Key: "channelId", Value: "UCchannel"},
+			{Key: "publishedAt", Value: time.Date(2024, 5, 1, hours, 0, 0, 0, time.UTC)},
+			{Key: "keywords", Value: keywords},
+		}
+	}
+	tests := []struct {
+		name     string
+		query    string
+		docs     []bson.D
+		wantSkip int64
+		want     []string
+		wantNext bool
+	}{
+		{
+			name:  "one page",
+			query: "limit=2",
+			docs:  []bson.D{video("catvideo001", 9, "cats", "pets"), video("petvideo001", 7, "pets")},
+			want:  []string{"cats/catvideo001", "pets/petvideo001"},
+		},
+		{
+			name:     "more pages",
+			query:    "limit=2&page=3",
+			docs:     []bson.D{video("catvideo001", 9, "cats"), video("petvideo001", 7, "pets"), video("dogvideo001", 5, "dogs")},
+			wantSkip: 6,
+			want:     []string{"cats/catvideo001", "pets/petvideo001"},
+			wantNext: true,
+		},
+		{
+			name:  "untagged video",
+			query: "limit=2",
+			docs:  []bson.D{video("oldvideo001", 9)},
+			want:  []string{"/oldvideo001"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			saved := database
+			defer func() { database = saved }()
+			database = mt.DB
+			sharedStorage = true
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "test._videos", mtest.FirstBatch, tt.docs...))
+
+			w := httptest.NewRecorder()
+			getChannelVideos(w, httptest.NewRequest(http.MethodGet, "/channels/UCchannel/videos?"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				mt.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			// A single query, whatever the number of keywords
+			events := mt.GetAllStartedEvents()
+			if len(events) != 1 || events[0].CommandName != "find" {
+				mt.Fatalf("ran %d commands, want a single find", len(events))
+			}
+			cmd := events[0].Command
+			if got := cmd.Lookup("find").StringValue(); got != "_videos" {
+				mt.Errorf("queried %s, want the shared collection", got)
+			}
+			if got := cmd.Lookup("filter", "channelId").StringValue(); got != "UCchannel" {
+				mt.Errorf("filtered by channel %q", got)
+			}
+			if got, _ := cmd.Lookup("skip").AsInt64OK(); got != tt.wantSkip {
+				mt.Errorf("skip = %d, want %d", got, tt.wantSkip)
+			}
+			if got := cmd.Lookup("limit").AsInt64(); got != 3 {
+				mt.Errorf("limit = %d, want a page and one more", got)
+			}
+
+			var response struct {
+				Result []struct {
+					YoutubeID string `json:"youtubeId"`
+					Keyword   string `json:"keyword"`
+				} `json:"result"`
+				Next string `json:"next"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				mt.Fatal(err)
+			}
+			var got []string
+			for _, v := range response.Result {
+				got = append(got, v.Keyword+"/"+v.YoutubeID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				mt.Errorf("result %v, want %v", got, tt.want)
+			}
+			if (response.Next != "") != tt.wantNext {
+				mt.Errorf("next = %q, want next %v", response.Next, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+type countResponse struct {
+	Keyword string `json:"keyword"`
+	Count   int64  `json:"count"`
+}
+
+// getCount serves GET /videos/{keyword}/count: how many videos are stored for
+// keyword, narrowed by the same filters as the videos list.
+func getCount(w http.ResponseWriter, r *http.Request, keyword string) {
+	keyword, keywordErr := validateKeyword(r.Context(), keyword)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+	filter, filterErr := videosFilter(r.URL.Query())
+	if filterErr != nil {
+		filterErr.writeHttpResponse(w)
+		return
+	}
+
+	filter = append(keywordFilter(keyword), filter...)
+	count, err := countVideos(r.Context(), videosCollection(keyword), r.URL.Query(), filter)
+	if err != nil {
+		log.Printf("Error: cannot count videos of %s: %v", keyword, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countResponse{Keyword: keyword, Count: count})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decodeFailures counts the documents that didn't decode into a Video and had
+// to be mapped field by field. Served on /status.
+var decodeFailures atomic.Int64
+
+// decoder is a cursor or a single result.
+type decoder interface {
+	Decode(v interface{}) error
+}
+
+// decodeVideo decodes the cursor's current document. Documents that don't
+// match Video, e.g. written by older versions or edited by hand, are mapped
+// best-effort instead of being dropped.
+func decodeVideo(cursor decoder) (Video, error) {
+	var v Video
+	err := cursor.Decode(&v)
+	if err == nil {
+		return v, nil
+	}
+	decodeFailures.Add(1)
+	log.Printf("Error: failed to decode result, mapping known fields: %v", err)
+
+	var doc bson.M
+	if err := cursor.Decode(&doc); err != nil {
+		return Video{}, err
+	}
+	return videoFromMap(doc), nil
+}
+
+// videoFromMap picks the Video fields out of doc that have the expected type.
+func videoFromMap(doc bson.M) Video {
+	var v Video
+	v.ID, _ = doc["_id"].(primitive.ObjectID)
+	v.YoutubeID, _ = doc["youtubeId"].(string)
+	v.Title, _ = doc["title"].(string)
+	v.Description, _ = doc["description"].(string)
+	v.ThumbnailUrl, _ = doc["thumbnailUrl"].(string)
+	v.ChannelID, _ = doc["channelId"].(string)
+	v.Source, _ = doc["source"].(string)
+	v.LiveBroadcastContent, _ = doc["liveBroadcastContent"].(string)
+	v.RegionCode, _ = doc["regionCode"].(string)
+	v.DescriptionCompressed, _ = doc["descriptionCompressed"].(bool)
+	if b, ok := doc["descriptionGzip"].(primitive.Binary); ok {
+		v.DescriptionGzip = b.Data
+	}
+	switch publishedAt := doc["publishedAt"].(type) {
+	case primitive.DateTime:
+		v.PublishedAt = publishedAt.Time()
+	case string:
+		v.PublishedAt, _ = time.Parse(time.RFC3339, publishedAt)
+	}
+	if firstSeenAt, ok := doc["firstSeenAt"].(primitive.DateTime); ok {
+		t := firstSeenAt.Time()
+		v.FirstSeenAt = &t
+	}
+	if t, ok := doc["thumbnails"].(bson.M); ok {
+		v.Thumbnails = &model.Thumbnails{
+			Default:  thumbnailFromMap(t["default"]),
+			Medium:   thumbnailFromMap(t["medium"]),
+			High:     thumbnailFromMap(t["high"]),
+			Standard: thumbnailFromMap(t["standard"]),
+			Maxres:   thumbnailFromMap(t["maxres"]),
+		}
+	}
+	v.Score, _ = doc["score"].(float64)
+	v.ViewCount = count(doc["viewCount"])
+	v.LikeCount = count(doc["likeCount"])
+	v.CommentCount = count(doc["commentCount"])
+	return v
+}
+
+func thumbnailFromMap(value interface{}) *model.Thumbnail {
+	doc, ok := value.(bson.M)
+	if !ok {
+		return nil
+	}
+	url, _ := doc["url"].(string)
+	if url == "" {
+		return nil
+	}
+	return &model.Thumbnail{Url: url, Width: count(doc["width"]), Height: count(doc["height"])}
+}
+
+// count reads a number of any BSON numeric type, or 0.
+func count(value interface{}) int64 {
+	switch n := value.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
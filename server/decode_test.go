@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// rawDecoder decodes a stored document, like a cursor positioned on it.
+type rawDecoder bson.Raw
+
+func (d rawDecoder) Decode(v interface{}) error {
+	return bson.Unmarshal(d, v)
+}
+
+func TestDecodeVideoMixedSchemas(t *testing.T) {
+	publishedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	docs := []bson.D{
+		{{Key: "youtubeId", Value: "validvideo1"}, {Key: "title", Value: "Cats"}, {Key: "publishedAt", Value: publishedAt}, {Key: "viewCount", Value: int64(10)}},
+		// Written by hand: a numeric title, a string date and an int32 count
+		{{Key: "youtubeId", Value: "malformed01"}, {Key: "title", Value: 42}, {Key: "publishedAt", Value: "2024-05-01T10:00:00Z"}, {Key: "viewCount", Value: int32(7)},
+			{Key: "thumbnails", Value: bson.D{{Key: "high", Value: bson.D{{Key: "url", Value: "https://i.ytimg.com/hq.jpg"}, {Key: "width", Value: 480.0}}}}}},
+		{{Key: "youtubeId", Value: "validvideo2"}, {Key: "title", Value: "Dogs"}, {Key: "publishedAt", Value: publishedAt}},
+	}
+	want := []struct {
+		youtubeID string
+		title     string
+		views     int64
+	}{
+		{"validvideo1", "Cats", 10},
+		{"malformed01", "", 7},
+		{"validvideo2", "Dogs", 0},
+	}
+
+	failuresBefore := decodeFailures.Load()
+	for i, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := decodeVideo(rawDecoder(raw))
+		if err != nil {
+			t.Fatalf("document %d: %v", i, err)
+		}
+		if v.YoutubeID != want[i].youtubeID || v.Title != want[i].title || v.ViewCount != want[i].views {
+			t.Errorf("document %d decoded to %s %q %d views, want %+v", i, v.YoutubeID, v.Title, v.ViewCount, want[i])
+		}
+		if !v.PublishedAt.Equal(publishedAt) {
+			t.Errorf("document %d: publishedAt = %v, want %v", i, v.PublishedAt, publishedAt)
+		}
+	}
+	if got := decodeFailures.Load() - failuresBefore; got != 1 {
+		t.Errorf("counted %d decode failures, want 1", got)
+	}
+}
+
+func TestVideoFromMapThumbnails(t *testing.T) {
+	v := videoFromMap(bson.M{"thumbnails": bson.M{
+		"high":    bson.M{"url": "https://i.ytimg.com/hq.jpg", "width": 480.0, "height": int32(360)},
+		"default": bson.M{"width": int64(120)},
+	}})
+	if v.Thumbnails == nil || v.Thumbnails.High == nil {
+		t.Fatalf("thumbnails = %+v", v.Thumbnails)
+	}
+	if h := v.Thumbnails.High; h.Width != 480 || h.Height != 360 {
+		t.Errorf("high thumbnail = %+v, want 480x360", h)
+	}
+	if v.Thumbnails.Default != nil {
+		t.Errorf("thumbnail without a url kept: %+v", v.Thumbnails.Default)
+	}
+}
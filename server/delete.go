@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"example.com/hello/internal/model"
+)
+
+// deleteVideos serves DELETE /videos/{keyword}: it drops the keyword's
+// collection, or with STORAGE_MODE=shared removes the keyword from the shared
+// one. Aliases aren't followed, so only a keyword of that name is deleted.
+func deleteVideos(w http.ResponseWriter, r *http.Request, keyword string) {
+	name, nameErr := model.ValidateCollectionName(keyword)
+	if nameErr != nil {
+		(&Error{http.StatusBadRequest, fmt.Sprintf("Invalid keyword %q: %v", keyword, nameErr)}).writeHttpResponse(w)
+		return
+	}
+	exists, keywordErr := collectionExists(r.Context(), name)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+	if !exists {
+		(&Error{http.StatusNotFound, fmt.Sprintf("Videos for %s are not being collected", name)}).writeHttpResponse(w)
+		return
+	}
+
+	if sharedStorage {
+		if err := removeSharedKeyword(r.Context(), name); err != nil {
+			log.Printf("Error: cannot delete the videos of %s: %v", name, err)
+			internalError.writeHttpResponse(w)
+			return
+		}
+	} else if err := database.Collection(name).Drop(r.Context()); err != nil {
+		log.Printf("Error: cannot drop %s: %v", name, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	existingCollections.remove(name)
+	invalidateKeywords()
+	log.Printf("Deleted the videos of %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
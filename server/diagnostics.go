@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type indexInfo struct {
+	Name    string `json:"name" bson:"name"`
+	Key     bson.M `json:"key" bson:"key"`
+	Unique  bool   `json:"unique,omitempty" bson:"unique,omitempty"`
+	Weights bson.M `json:"weights,omitempty" bson:"weights,omitempty"`
+}
+
+type diagnosticsResponseMsg struct {
+	Keyword     string      `json:"keyword"`
+	Count       int64       `json:"count"`
+	StorageSize int64       `json:"storageSize"`
+	Indexes     []indexInfo `json:"indexes"`
+	// Whether the indexes the worker creates are present
+	ExpectedIndexes map[string]bool `json:"expectedIndexes"`
+	Healthy         bool            `json:"healthy"`
+}
+
+// getDiagnostics serves GET /videos/{keyword}/diagnostics: the collection's
+// size and indexes, and whether the ones search and ordering rely on exist.
+// With STORAGE_MODE=shared that's the shared collection all keywords share.
+func getDiagnostics(w http.ResponseWriter, r *http.Request, keyword string) {
+	keyword, keywordErr := validateKeyword(r.Context(), keyword)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+	collection := videosCollection(keyword)
+
+	cursor, err := collection.Aggregate(r.Context(), mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}},
+	})
+	if err != nil {
+		log.Printf("Error: cannot get stats of %s: %v", keyword, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	var stats []struct {
+		StorageStats struct {
+			Count       int64 `bson:"count"`
+			StorageSize int64 `bson:"storageSize"`
+		} `bson:"storageStats"`
+	}
+	if err := cursor.All(r.Context(), &stats); err != nil {
+		log.Printf("Error: cannot decode stats of %s: %v", keyword, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+
+	cursor, err = collection.Indexes().List(r.Context())
+	if err != nil {
+		log.Printf("Error: cannot list indexes of %s: %v", keyword, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	var indexes []indexInfo
+	if err := cursor.All(r.Context(), &indexes); err != nil {
+		log.Printf("Error: cannot decode indexes of %s: %v", keyword, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+
+	response := diagnosticsResponseMsg{
+		Keyword: keyword,
+		Indexes: indexes,
+		ExpectedIndexes: map[string]bool{
+			"publishedAt": false,
+			"text":        false,
+			"youtubeId":   false,
+		},
+	}
+	if sharedStorage {
+		response.ExpectedIndexes["keywords"] = false
+	}
+	// Sharded collections have stats per shard
+	for _, s := range stats {
+		response.Count += s.StorageStats.Count
+		response.StorageSize += s.StorageStats.StorageSize
+	}
+	for _, index := range indexes {
+		switch {
+		case len(index.Key) == 1 && index.Key["publishedAt"] != nil:
+			response.ExpectedIndexes["publishedAt"] = true
+		case index.Key["_fts"] == "text" && index.Weights["title"] != nil && index.Weights["description"] != nil:
+			response.ExpectedIndexes["text"] = true
+		case len(index.Key) == 1 && index.Key["youtubeId"] != nil && index.Unique:
+			response.ExpectedIndexes["youtubeId"] = true
+		case sharedStorage && index.Key["keywords"] != nil:
+			response.ExpectedIndexes["keywords"] = true
+		}
+	}
+	response.Healthy = true
+	for _, present := range response.ExpectedIndexes {
+		response.Healthy = response.Healthy && present
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetDiagnostics(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	idIndex := bson.D{{Key: "name", Value: "_id_"}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}}
+	publishedAtIndex := bson.D{{Key: "name", Value: "publishedAt_-1"}, {Key: "key", Value: bson.D{{Key: "publishedAt", Value: -1}}}}
+	textIndex := bson.D{
+		{Key: "name", Value: "title_text_description_text"},
+		{Key: "key", Value: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: 1}}},
+		{Key: "weights", Value: bson.D{{Key: "title", Value: 1}, {Key: "description", Value: 1}}},
+	}
+	youtubeIDIndex := bson.D{{Key: "name", Value: "youtubeId_1"}, {Key: "key", Value: bson.D{{Key: "youtubeId", Value: 1}}}, {Key: "unique", Value: true}}
+	tests := []struct {
+		name        string
+		indexes     []bson.D
+		wantIndexes map[string]bool
+		wantHealthy bool
+	}{
+		{
+			"all indexes",
+			[]bson.D{idIndex, publishedAtIndex, textIndex, youtubeIDIndex},
+			map[string]bool{"publishedAt": true, "text": true, "youtubeId": true},
+			true,
+		},
+		{
+			"missing text index",
+			[]bson.D{idIndex, publishedAtIndex, youtubeIDIndex},
+			map[string]bool{"publishedAt": true, "text": false, "youtubeId": true},
+			false,
+		},
+		{
+			"youtubeId index not unique",
+			[]bson.D{idIndex, publishedAtIndex, textIndex, {{Key: "name", Value: "youtubeId_1"}, {Key: "key", Value: bson.D{{Key: "youtubeId", Value: 1}}}}},
+			map[string]bool{"publishedAt": true, "text": true, "youtubeId": false},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			existingCollections.add("cats")
+
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, bson.D{{Key: "storageStats", Value: bson.D{
+					{Key: "count", Value: int64(120)}, {Key: "storageSize", Value: int64(4096)},
+				}}}),
+				mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, tt.indexes...),
+			)
+			w := httptest.NewRecorder()
+			getDiagnostics(w, httptest.NewRequest(http.MethodGet, "/videos/cats/diagnostics", nil), "cats")
+			if w.Code != http.StatusOK {
+				mt.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var got diagnosticsResponseMsg
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				mt.Fatal(err)
+			}
+			if got.Count != 120 || got.StorageSize != 4096 || len(got.Indexes) != len(tt.indexes) {
+				mt.Errorf("count %d, size %d, %d indexes", got.Count, got.StorageSize, len(got.Indexes))
+			}
+			if !reflect.DeepEqual(got.ExpectedIndexes, tt.wantIndexes) || got.Healthy != tt.wantHealthy {
+				mt.Errorf("expected indexes %v, healthy %v, want %v, %v", got.ExpectedIndexes, got.Healthy, tt.wantIndexes, tt.wantHealthy)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// getDump serves GET /videos/{keyword}/dump: every document of the keyword,
+// _id included, as canonical extended JSON, one per line. That's the format
+// mongoimport reads by default. Documents are streamed off the cursor, so
+// large collections aren't held in memory. The X-Dump-Complete trailer is
+// true once every document is sent, false when the dump stopped early, eg:
+// because the server shut down.
+func getDump(w http.ResponseWriter, r *http.Request, keyword string) {
+	keyword, keywordErr := validateKeyword(r.Context(), keyword)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+
+	cursor, err := videosCollection(keyword).Find(r.Context(), keywordFilter(keyword))
+	if err != nil {
+		log.Printf("Error: cannot dump %s: %v", keyword, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	w.Header().Set("Trailer", "X-Dump-Complete")
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", keyword+".json"))
+	for cursor.Next(r.Context()) {
+		doc, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			// The status is already sent, the truncated dump is all we can do
+			log.Printf("Error: cannot encode document of %s: %v", keyword, err)
+			w.Header().Set("X-Dump-Complete", "false")
+			return
+		}
+		if _, err := w.Write(append(doc, '\n')); err != nil {
+			return
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error: dump of %s stopped: %v", keyword, err)
+		w.Header().Set("X-Dump-Complete", "false")
+		return
+	}
+	w.Header().Set("X-Dump-Complete", "true")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetDump(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "youtubeId", Value: "dQw4w9WgXcQ"},
+			{Key: "publishedAt", Value: primitive.NewDateTimeFromTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))},
+			{Key: "viewCount", Value: int64(1 << 40)},
+			{Key: "thumbnails", Value: bson.D{{Key: "default", Value: bson.D{{Key: "width", Value: int32(120)}}}}},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "youtubeId", Value: "9bZkp7q19f0"},
+			{Key: "description", Value: primitive.Binary{Data: []byte{0x1f, 0x8b}}},
+			{Key: "title", Value: "line one\nline two \"quoted\""},
+		},
+	}
+	tests := []struct {
+		name         string
+		responses    []bson.D
+		wantDocs     int
+		wantComplete string
+	}{
+		{
+			name:         "whole collection",
+			responses:    []bson.D{mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, docs...)},
+			wantDocs:     2,
+			wantComplete: "true",
+		},
+		{
+			name: "cursor fails part way",
+			responses: []bson.D{
+				mtest.CreateCursorResponse(1, "test.cats", mtest.FirstBatch, docs[0]),
+				mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "unauthorized"}),
+			},
+			wantDocs:     1,
+			wantComplete: "false",
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			existingCollections.add("cats")
+			mt.AddMockResponses(tt.responses...)
+
+			w := httptest.NewRecorder()
+			getDump(w, httptest.NewRequest(http.MethodGet, "/videos/cats/dump", nil), "cats")
+			res := w.Result()
+			if res.StatusCode != http.StatusOK {
+				mt.Fatalf("status %d: %s", res.StatusCode, w.Body)
+			}
+			if got := res.Header.Get("Content-Type"); got != "application/x-ndjson" {
+				mt.Errorf("Content-Type = %q", got)
+			}
+			if got := res.Trailer.Get("X-Dump-Complete"); got != tt.wantComplete {
+				mt.Errorf("X-Dump-Complete = %q, want %q", got, tt.wantComplete)
+			}
+
+			// Each line is a document as mongoimport would read it back
+			lines := bufio.NewScanner(bytes.NewReader(w.Body.Bytes()))
+			n := 0
+			for ; lines.Scan(); n++ {
+				var got bson.D
+				if err := bson.UnmarshalExtJSON(lines.Bytes(), true, &got); err != nil {
+					mt.Fatalf("line %d isn't extended JSON: %v: %s", n+1, err, lines.Bytes())
+				}
+				if n >= len(docs) {
+					break
+				}
+				gotBytes, _ := bson.Marshal(got)
+				wantBytes, _ := bson.Marshal(docs[n])
+				if !bytes.Equal(gotBytes, wantBytes) {
+					mt.Errorf("line %d = %v, want %v", n+1, got, docs[n])
+				}
+			}
+			if n != tt.wantDocs {
+				mt.Errorf("dumped %d documents, want %d", n, tt.wantDocs)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeWithETag sends body with a weak ETag of it, its content type and the
+// request's query, or just 304 when the request's If-None-Match has that ETag
+// already, so polling clients don't download unchanged pages again.
+func writeWithETag(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	if notModified(w, r, etagFor(r, []byte(contentType), body)) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// etagFor returns a weak ETag of the request's query and parts. The query
+// params are sorted, so the order they're given in doesn't matter.
+func etagFor(r *http.Request, parts ...[]byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.URL.Query().Encode()))
+	for _, part := range parts {
+		h.Write([]byte{0})
+		h.Write(part)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// listETag is the weak ETag of a page of a keyword's videos, sent in the
+// contentType: of the query, and the total and newest publishedAt of the
+// videos matching the list's filters. HEAD sends the same one as GET without
+// reading the page, and GET can answer 304 before querying it.
+func listETag(r *http.Request, contentType string, total int64, newest time.Time) string {
+	return etagFor(r, []byte(contentType), []byte(strconv.FormatInt(total, 10)), []byte(newest.UTC().Format(time.RFC3339Nano)))
+}
+
+// notModified sets the ETag header, and responds 304 when the request's
+// If-None-Match has etag already.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// etagMatches reports whether the If-None-Match header value has etag,
+// comparing weakly.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONWithETag encodes response as JSON and sends it with writeWithETag.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error: cannot encode response: %v", err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	writeWithETag(w, r, "application/json", append(body, '\n'))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// projectableFields are the fields ?fields= can pick: the stored ones of
+// model.Video that responses include.
+var projectableFields = storedFields(reflect.TypeOf(model.Video{}))
+
+// storedFields returns the bson names of t's fields, leaving out the ones
+// never sent as JSON.
+func storedFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("json") == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("bson"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// fieldsProjection builds the projection of the comma separated fields param,
+// nil when it's not set. youtubeId is always included, and so is what the
+// response needs to work out cursors and ages.
+func fieldsProjection(q url.Values) (bson.D, *Error) {
+	param := q.Get("fields")
+	if param == "" {
+		return nil, nil
+	}
+	projection := bson.D{}
+	included := map[string]bool{}
+	include := func(field string) {
+		if !included[field] {
+			included[field] = true
+			projection = append(projection, bson.E{Key: field, Value: 1})
+		}
+	}
+	include("youtubeId")
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if field == "_id" && !exposeMongoID {
+			return nil, &Error{http.StatusBadRequest, "Field _id is not exposed"}
+		}
+		if !projectableFields[field] {
+			return nil, &Error{http.StatusBadRequest, fmt.Sprintf("Unknown field %q", field)}
+		}
+		include(field)
+		if field == "description" {
+			// Compressed descriptions are stored in these instead
+			include("descriptionGzip")
+			include("descriptionCompressed")
+		}
+	}
+	if q.Get("mode") == "cursor" || q.Get("age") == "true" {
+		include("publishedAt")
+	}
+	return projection, nil
+}
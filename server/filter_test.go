@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestVideosFilterHasStats(t *testing.T) {
+	tests := []struct {
+		hasStats string
+		want     bson.D
+	}{
+		{"", bson.D{}},
+		{"true", bson.D{{Key: "enriched", Value: true}}},
+		{"false", bson.D{{Key: "enriched", Value: bson.D{{Key: "$ne", Value: true}}}}},
+		{"maybe", bson.D{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hasStats, func(t *testing.T) {
+			filter, err := videosFilter(url.Values{"hasStats": {tt.hasStats}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(filter, tt.want) {
+				t.Errorf("filter = %v, want %v", filter, tt.want)
+			}
+		})
+	}
+}
+
+func TestVideosFilterLive(t *testing.T) {
+	tests := []struct {
+		live string
+		want bson.D
+	}{
+		{"", bson.D{}},
+		{"true", bson.D{{Key: "liveBroadcastContent", Value: "live"}}},
+		{"false", bson.D{{Key: "liveBroadcastContent", Value: bson.D{{Key: "$ne", Value: "live"}}}}},
+		{"upcoming", bson.D{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.live, func(t *testing.T) {
+			filter, err := videosFilter(url.Values{"live": {tt.live}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(filter, tt.want) {
+				t.Errorf("filter = %v, want %v", filter, tt.want)
+			}
+		})
+	}
+}
+
+func TestVideosFilterTextLanguage(t *testing.T) {
+	defer func(language string) { textLanguage = language }(textLanguage)
+
+	tests := []struct {
+		language string
+		want     bson.D
+	}{
+		{"", bson.D{{Key: "$search", Value: "gatos"}}},
+		{"spanish", bson.D{{Key: "$search", Value: "gatos"}, {Key: "$language", Value: "spanish"}}},
+		{"none", bson.D{{Key: "$search", Value: "gatos"}, {Key: "$language", Value: "none"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			textLanguage = tt.language
+			filter, err := videosFilter(url.Values{"search": {"gatos"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := bson.D{{Key: "$text", Value: tt.want}}
+			if !reflect.DeepEqual(filter, want) {
+				t.Errorf("filter = %v, want %v", filter, want)
+			}
+		})
+	}
+}
+
+// TestGetVideosSearchLanguage checks the searches mongo runs against the text
+// index are in its configured language.
+func TestGetVideosSearchLanguage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("spanish", func(mt *mtest.T) {
+		savedDB, savedCollections, savedLanguage := database, existingCollections, textLanguage
+		defer func() { database, existingCollections, textLanguage = savedDB, savedCollections, savedLanguage }()
+		database = mt.DB
+		existingCollections = newCollectionCache(defaultMaxCachedCollections)
+		existingCollections.add("cats")
+		textLanguage = "spanish"
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, bson.D{{Key: "n", Value: int32(1)}}),
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, bson.D{{Key: "youtubeId", Value: "dQw4w9WgXcQ"}}),
+		)
+		w := httptest.NewRecorder()
+		getVideos(w, httptest.NewRequest(http.MethodGet, "/videos/cats?search=gatos", nil), "cats")
+		if w.Code != http.StatusOK {
+			mt.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var finds int
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName != "find" {
+				continue
+			}
+			finds++
+			text := e.Command.Lookup("filter", "$text").Document()
+			if got := text.Lookup("$search").StringValue(); got != "gatos" {
+				mt.Errorf("searched %q, want gatos", got)
+			}
+			if got, _ := text.Lookup("$language").StringValueOK(); got != "spanish" {
+				mt.Errorf("searched in %q, want spanish", got)
+			}
+		}
+		if finds == 0 {
+			mt.Error("no search ran")
+		}
+	})
+}
+
+// TestHasStatsMatchesEnriched checks the hasStats filters against the
+// documents the worker writes, enriched or not.
+func TestHasStatsMatchesEnriched(t *testing.T) {
+	enriched, _ := bson.Marshal(model.Video{YoutubeID: "a", ViewCount: 10, Enriched: true})
+	hidden, _ := bson.Marshal(model.Video{YoutubeID: "b", Enriched: true})
+	failed, _ := bson.Marshal(model.Video{YoutubeID: "c"})
+
+	matches := func(hasStats string, doc []byte) bool {
+		filter, _ := videosFilter(url.Values{"hasStats": {hasStats}})
+		var m bson.M
+		bson.Unmarshal(doc, &m)
+		for _, e := range filter {
+			if ne, ok := e.Value.(bson.D); ok {
+				if m[e.Key] == ne[0].Value {
+					return false
+				}
+			} else if m[e.Key] != e.Value {
+				return false
+			}
+		}
+		return true
+	}
+	for _, doc := range [][]byte{enriched, hidden} {
+		if !matches("true", doc) || matches("false", doc) {
+			t.Errorf("enriched video %v should only match hasStats=true", bson.Raw(doc))
+		}
+	}
+	if matches("true", failed) || !matches("false", failed) {
+		t.Error("unenriched video should only match hasStats=false")
+	}
+}
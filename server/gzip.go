@@ -0,0 +1,118 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// defaultGzipMinSize is the response size below which gzip isn't worth it.
+const defaultGzipMinSize = 1024
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the first minSize bytes of a response to
+// decide whether it's big enough to be compressed.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status int
+	buf    []byte
+	gz     *gzip.Writer
+	// Set once it's decided to send the response as is
+	plain bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.gz != nil || w.plain {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.plain:
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.minSize {
+		return len(b), nil
+	}
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// start sends the held back bytes, compressed unless the handler already
+// encoded the response itself.
+func (w *gzipResponseWriter) start() error {
+	h := w.Header()
+	if h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	} else {
+		w.plain = true
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish sends what's left once the handler is done. Responses that stayed
+// under minSize go out uncompressed.
+func (w *gzipResponseWriter) finish() {
+	if w.gz != nil {
+		w.gz.Close()
+		return
+	}
+	if w.plain {
+		return
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) != 0 {
+		w.ResponseWriter.Write(w.buf)
+	}
+}
+
+// gzipResponses compresses the responses of next of at least minSize bytes
+// for clients accepting gzip.
+func gzipResponses(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
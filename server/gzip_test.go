@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"example.com/hello/internal/model"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8", true},
+		{"*", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.000", false},
+		{"br, deflate", false},
+		{"gzip;q=0.5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/videos/cats", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			if got := acceptsGzip(r); got != tt.want {
+				t.Errorf("acceptsGzip() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGzipResponsesRoundTrip(t *testing.T) {
+	var videos []Video
+	for i := 0; i < 50; i++ {
+		videos = append(videos, Video{Video: model.Video{
+			YoutubeID:   "video" + strconv.Itoa(i),
+			Title:       "Cats being cats, part " + strconv.Itoa(i),
+			Description: "A rather long description of what the cats get up to in this video",
+		}})
+	}
+	large, err := json.Marshal(videosResponseMsg{Limit: 50, Result: videos})
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := []byte(`{"keywords":["cats"]}`)
+
+	tests := []struct {
+		name           string
+		body           []byte
+		method         string
+		acceptEncoding string
+		// Set by the handler, eg: an already compressed response
+		contentEncoding string
+		wantGzip        bool
+	}{
+		{"large response", large, http.MethodGet, "gzip", "", true},
+		{"small response", small, http.MethodGet, "gzip", "", false},
+		{"client without gzip", large, http.MethodGet, "", "", false},
+		{"already encoded", large, http.MethodGet, "gzip", "br", false},
+		{"head", large, http.MethodHead, "gzip", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := gzipResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				w.WriteHeader(http.StatusOK)
+				// In pieces, like json.Encoder and streams do
+				for b := tt.body; len(b) > 0; {
+					n := 300
+					if n > len(b) {
+						n = len(b)
+					}
+					w.Write(b[:n])
+					b = b[n:]
+				}
+			}), defaultGzipMinSize)
+			r := httptest.NewRequest(tt.method, "/videos/cats", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Result().Header.Get("Vary") != "Accept-Encoding" {
+				t.Error("missing Vary: Accept-Encoding")
+			}
+			body := w.Body.Bytes()
+			gzipped := w.Result().Header.Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.wantGzip)
+			}
+			if gzipped {
+				if len(body) >= len(tt.body) {
+					t.Errorf("compressed to %d bytes from %d", len(body), len(tt.body))
+				}
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(body, tt.body) {
+				t.Errorf("body of %d bytes, want the %d sent", len(body), len(tt.body))
+			}
+		})
+	}
+}
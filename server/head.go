@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// headVideos serves HEAD /videos/{keyword} without querying the videos
+// themselves: X-Total-Count is how many match the list's filters,
+// Last-Modified when the newest of them was published, and the ETag the same
+// as GET's.
+func headVideos(w http.ResponseWriter, r *http.Request, keyword string) {
+	keyword, keywordErr := validateKeyword(r.Context(), keyword)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+	q := r.URL.Query()
+	filter, filterErr := videosFilter(q)
+	if filterErr != nil {
+		filterErr.writeHttpResponse(w)
+		return
+	}
+
+	filter = append(keywordFilter(keyword), filter...)
+	total, newest, err := listMetadata(r.Context(), videosCollection(keyword), q, filter)
+	if err != nil {
+		internalError.writeHttpResponse(w)
+		return
+	}
+
+	if !newest.IsZero() {
+		w.Header().Set("Last-Modified", newest.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	contentType := videosContentType(r)
+	if notModified(w, r, listETag(r, contentType, total, newest)) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+}
+
+// listMetadata returns how many videos of collection match filter, and when
+// the newest of them was published, zero if there are none.
+func listMetadata(ctx context.Context, collection *mongo.Collection, q url.Values, filter bson.D) (int64, time.Time, error) {
+	total, err := countVideos(ctx, collection, q, filter)
+	if err != nil {
+		log.Printf("Error: cannot count videos: %v", err)
+		return 0, time.Time{}, err
+	}
+	var newest struct {
+		PublishedAt time.Time `bson:"publishedAt"`
+	}
+	err = collection.FindOne(ctx, filter, options.FindOne().
+		SetSort(bson.D{{Key: "publishedAt", Value: -1}}).
+		SetProjection(bson.D{{Key: "publishedAt", Value: 1}})).Decode(&newest)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error: cannot get newest video: %v", err)
+		return 0, time.Time{}, err
+	}
+	return total, newest.PublishedAt, nil
+}
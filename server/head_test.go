@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestHeadVideosETag(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	newest := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	// The count and newest video of the list, which both methods look up
+	metadata := func(total int32) []bson.D {
+		return []bson.D{
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, bson.D{{Key: "n", Value: total}}),
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, bson.D{{Key: "publishedAt", Value: newest}}),
+		}
+	}
+	page := mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch,
+		bson.D{{Key: "youtubeId", Value: "dQw4w9WgXcQ"}, {Key: "publishedAt", Value: newest}})
+
+	serve := func(mt *mtest.T, method, target, accept, ifNoneMatch string, responses ...bson.D) *httptest.ResponseRecorder {
+		mt.Helper()
+		mt.ClearEvents()
+		mt.AddMockResponses(responses...)
+		r := httptest.NewRequest(method, target, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		videosHandler(w, r)
+		return w
+	}
+	tests := []struct {
+		name   string
+		target string
+		accept string
+	}{
+		{"plain", "/videos/cats", ""},
+		{"filtered", "/videos/cats?live=true&within=7d", ""},
+		{"paged", "/videos/cats?page=2&limit=5", ""},
+		{"protobuf", "/videos/cats", protobufContentType},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			existingCollections.add("cats")
+
+			head := serve(mt, http.MethodHead, tt.target, tt.accept, "", metadata(21)...)
+			get := serve(mt, http.MethodGet, tt.target, tt.accept, "", append(metadata(21), page)...)
+			if head.Code != http.StatusOK || get.Code != http.StatusOK {
+				mt.Fatalf("HEAD status %d, GET status %d: %s", head.Code, get.Code, get.Body)
+			}
+			etag := head.Header().Get("ETag")
+			if etag == "" || get.Header().Get("ETag") != etag {
+				mt.Fatalf("HEAD ETag %q, GET ETag %q, want them equal", etag, get.Header().Get("ETag"))
+			}
+			if head.Body.Len() != 0 {
+				mt.Errorf("HEAD sent a body: %s", head.Body)
+			}
+			if got := head.Header().Get("Content-Type"); got != get.Header().Get("Content-Type") {
+				mt.Errorf("HEAD Content-Type %q, GET %q", got, get.Header().Get("Content-Type"))
+			}
+
+			// The ETag of one revalidates the other, and GET doesn't query the page
+			if w := serve(mt, http.MethodGet, tt.target, tt.accept, etag, metadata(21)...); w.Code != http.StatusNotModified {
+				mt.Errorf("GET with HEAD's ETag: status %d, want 304", w.Code)
+			} else if n := len(mt.GetAllStartedEvents()); n != 2 {
+				mt.Errorf("GET answering 304 ran %d commands, want the count and newest video", n)
+			}
+			if w := serve(mt, http.MethodHead, tt.target, tt.accept, etag, metadata(21)...); w.Code != http.StatusNotModified {
+				mt.Errorf("HEAD with GET's ETag: status %d, want 304", w.Code)
+			}
+			// A new video changes it
+			if w := serve(mt, http.MethodHead, tt.target, tt.accept, "", metadata(22)...); w.Header().Get("ETag") == etag {
+				mt.Errorf("ETag %q unchanged by another video", etag)
+			}
+		})
+	}
+}
+
+func TestListETag(t *testing.T) {
+	newest := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	base := listETag(httptest.NewRequest(http.MethodGet, "/videos/cats?limit=5&page=1", nil), "application/json", 21, newest)
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		total       int64
+		newest      time.Time
+		wantSame    bool
+	}{
+		{"same", "/videos/cats?limit=5&page=1", "application/json", 21, newest, true},
+		{"params reordered", "/videos/cats?page=1&limit=5", "application/json", 21, newest, true},
+		{"other page", "/videos/cats?limit=5&page=2", "application/json", 21, newest, false},
+		{"other limit", "/videos/cats?limit=6&page=1", "application/json", 21, newest, false},
+		{"searched", "/videos/cats?limit=5&page=1&search=kittens", "application/json", 21, newest, false},
+		{"sorted", "/videos/cats?limit=5&page=1&sort=oldest", "application/json", 21, newest, false},
+		{"protobuf", "/videos/cats?limit=5&page=1", protobufContentType, 21, newest, false},
+		{"another video", "/videos/cats?limit=5&page=1", "application/json", 22, newest, false},
+		{"newer video", "/videos/cats?limit=5&page=1", "application/json", 21, newest.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := listETag(httptest.NewRequest(http.MethodGet, tt.target, nil), tt.contentType, tt.total, tt.newest)
+			if (got == base) != tt.wantSame {
+				t.Errorf("listETag() = %q, base %q, want same %v", got, base, tt.wantSame)
+			}
+		})
+	}
+}
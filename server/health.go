@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// healthTimeout bounds the database ping of a health check.
+const healthTimeout = 2 * time.Second
+
+// getHealth serves GET /healthz for liveness and readiness probes: 200 with
+// {"status": "ok"} while mongo answers pings, 503 otherwise.
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	status, code := "ok", http.StatusOK
+	if err := database.Client().Ping(ctx, nil); err != nil {
+		log.Printf("Error: health check ping failed: %v", err)
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
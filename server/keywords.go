@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// keywordsTTL is how long GET /keywords reuses a listing of the collections.
+const keywordsTTL = 30 * time.Second
+
+var keywordsCache struct {
+	sync.Mutex
+	keywords  []string
+	fetchedAt time.Time
+	// generation changes when the cache is invalidated, so a listing that
+	// started before isn't stored
+	generation int
+}
+
+// invalidateKeywords makes the next GET /keywords list the collections again.
+func invalidateKeywords() {
+	keywordsCache.Lock()
+	keywordsCache.fetchedAt = time.Time{}
+	keywordsCache.generation++
+	keywordsCache.Unlock()
+}
+
+type keywordsResponseMsg struct {
+	Keywords []string `json:"keywords"`
+}
+
+// getKeywords serves GET /keywords: the search terms being collected.
+func getKeywords(w http.ResponseWriter, r *http.Request) {
+	// The lock isn't held while listing, so requests don't queue behind mongo
+	keywordsCache.Lock()
+	keywords, fetchedAt, generation := keywordsCache.keywords, keywordsCache.fetchedAt, keywordsCache.generation
+	keywordsCache.Unlock()
+	if time.Since(fetchedAt) > keywordsTTL {
+		var err error
+		keywords, err = keywordCollections(r.Context())
+		if err != nil {
+			log.Printf("Error: cannot list keywords: %v", err)
+			internalError.writeHttpResponse(w)
+			return
+		}
+		sort.Strings(keywords)
+		// Saves validateKeyword a lookup for the keywords clients go on to request
+		for _, k := range keywords {
+			existingCollections.add(k)
+		}
+		keywordsCache.Lock()
+		if keywordsCache.generation == generation {
+			keywordsCache.keywords, keywordsCache.fetchedAt = keywords, time.Now()
+		}
+		keywordsCache.Unlock()
+	}
+
+	response := keywordsResponseMsg{Keywords: keywords}
+	if response.Keywords == nil {
+		response.Keywords = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// resetKeywordsCache empties keywordsCache for a test and restores it after.
+func resetKeywordsCache(t *testing.T) {
+	t.Helper()
+	keywordsCache.Lock()
+	keywords, fetchedAt := keywordsCache.keywords, keywordsCache.fetchedAt
+	keywordsCache.keywords, keywordsCache.fetchedAt = nil, time.Time{}
+	keywordsCache.Unlock()
+	t.Cleanup(func() {
+		keywordsCache.Lock()
+		keywordsCache.keywords, keywordsCache.fetchedAt = keywords, fetchedAt
+		keywordsCache.Unlock()
+	})
+}
+
+func TestGetKeywords(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	listing := mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch,
+		bson.D{{Key: "name", Value: "dogs"}}, bson.D{{Key: "name", Value: "_runs"}}, bson.D{{Key: "name", Value: "cats"}})
+	failed := mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "unauthorized"})
+	tests := []struct {
+		name       string
+		cached     []string
+		fetchedAgo time.Duration
+		invalidate bool
+		response   bson.D
+		wantCode   int
+		want       []string
+		wantListed bool
+	}{
+		{"first request lists", nil, 0, false, listing, http.StatusOK, []string{"cats", "dogs"}, true},
+		{"fresh cache is reused", []string{"birds"}, time.Second, false, nil, http.StatusOK, []string{"birds"}, false},
+		{"stale cache lists again", []string{"birds"}, keywordsTTL + time.Second, false, listing, http.StatusOK, []string{"cats", "dogs"}, true},
+		{"invalidated cache lists again", []string{"birds"}, time.Second, true, listing, http.StatusOK, []string{"cats", "dogs"}, true},
+		{"listing fails", nil, 0, false, failed, http.StatusInternalServerError, nil, true},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			resetKeywordsCache(mt.T)
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			if tt.cached != nil {
+				keywordsCache.keywords, keywordsCache.fetchedAt = tt.cached, time.Now().Add(-tt.fetchedAgo)
+			}
+			if tt.invalidate {
+				invalidateKeywords()
+			}
+			if tt.response != nil {
+				mt.AddMockResponses(tt.response)
+			}
+
+			w := httptest.NewRecorder()
+			getKeywords(w, httptest.NewRequest(http.MethodGet, "/keywords", nil))
+			if w.Code != tt.wantCode {
+				mt.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if listed := len(mt.GetAllStartedEvents()) != 0; listed != tt.wantListed {
+				mt.Errorf("listed collections: %v, want %v", listed, tt.wantListed)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp keywordsResponseMsg
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				mt.Fatal(err)
+			}
+			if !reflect.DeepEqual(resp.Keywords, tt.want) {
+				mt.Errorf("keywords = %v, want %v", resp.Keywords, tt.want)
+			}
+			if !reflect.DeepEqual(keywordsCache.keywords, tt.want) {
+				mt.Errorf("cached %v, want %v", keywordsCache.keywords, tt.want)
+			}
+		})
+	}
+}
+
+// TestGetKeywordsUnlockedWhileListing checks the cache isn't locked during the
+// listing, which would queue every other /keywords request behind mongo.
+func TestGetKeywordsUnlockedWhileListing(t *testing.T) {
+	resetKeywordsCache(t)
+	// Fails after its server selection timeout, the time the listing takes
+	unreachableDatabase(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		getKeywords(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/keywords", nil))
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if !keywordsCache.TryLock() {
+			t.Fatal("keywordsCache is locked while listing the collections")
+		}
+		keywordsCache.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRequestTimeout bounds the handling of a videos request unless REQUEST_TIMEOUT is set
+	defaultRequestTimeout = 30 * time.Second
+	// defaultMaxConcurrentRequests is how many videos requests are handled at once unless MAX_CONCURRENT_REQUESTS is set
+	defaultMaxConcurrentRequests = 100
+	// retryAfterSeconds is when clients turned away for concurrency are told to retry
+	retryAfterSeconds = "1"
+)
+
+var (
+	timeoutError         = Error{http.StatusServiceUnavailable, "Request timed out"}
+	tooManyRequestsError = Error{http.StatusTooManyRequests, "Too many requests, retry later"}
+)
+
+// timeoutWriter turns the internal error a handler responds with once its
+// request timed out into a timeoutError.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	if status == http.StatusInternalServerError && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+		timeoutError.writeHttpResponse(w.ResponseWriter)
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	// The internal error's body
+	if w.timedOut {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// requestLimiter returns a wrapper limiting the handlers it wraps to
+// maxConcurrent requests at once between them, responding 429 to the ones
+// over it, and cancelling the queries of requests taking longer than timeout.
+// Dumps aren't bounded by timeout, as they take as long as the collection is
+// big. Zero disables either limit.
+func requestLimiter(timeout time.Duration, maxConcurrent int) func(http.HandlerFunc) http.HandlerFunc {
+	var slots chan struct{}
+	if maxConcurrent > 0 {
+		slots = make(chan struct{}, maxConcurrent)
+	}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return limitRequests(next, timeout, slots)
+	}
+}
+
+// isDump reports whether r is for a keyword's dump, /videos/{keyword}/dump,
+// and not eg: the videos of a keyword named dump.
+func isDump(r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, "/videos/") {
+		return false
+	}
+	_, resource, err := splitVideosPath(r)
+	return err == nil && resource == "dump"
+}
+
+func limitRequests(next http.HandlerFunc, timeout time.Duration, slots chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				w.Header().Set("Retry-After", retryAfterSeconds)
+				tooManyRequestsError.writeHttpResponse(w)
+				return
+			}
+		}
+		if timeout > 0 && !isDump(r) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			w = &timeoutWriter{ResponseWriter: w, ctx: ctx}
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimitRequestsDumpTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		wantTimeout bool
+	}{
+		{"videos", "/videos/cats", true},
+		{"video", "/videos/cats/dQw4w9WgXcQ", true},
+		{"dump", "/videos/cats/dump", false},
+		{"encoded keyword dump", "/videos/machine%20learning/dump", false},
+		{"keyword named dump", "/videos/dump", true},
+		{"keyword ending in an encoded /dump", "/videos/cats%2Fdump", true},
+		{"multi keyword videos", "/videos?keywords=dump", true},
+		{"dump of dump", "/videos/dump/dump", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hasDeadline bool
+			handler := limitRequests(func(w http.ResponseWriter, r *http.Request) {
+				_, hasDeadline = r.Context().Deadline()
+			}, time.Minute, nil)
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if hasDeadline != tt.wantTimeout {
+				t.Errorf("%s has a deadline: %v, want %v", tt.target, hasDeadline, tt.wantTimeout)
+			}
+		})
+	}
+}
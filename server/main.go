@@ -3,60 +3,132 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"example.com/hello/internal/logging"
+	"example.com/hello/internal/model"
+	"example.com/hello/internal/mongoenv"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 const (
 	defaultLimit = 10
 	maxLimit     = 50
+	maxKeywords  = 10
+	maxWithin    = 365 * 24 * time.Hour
+	// maxMergedOffset is how deep the pages merged from several collections
+	// reach, as each page reads all the ones before it from every collection
+	maxMergedOffset = 1000
 )
 
 type Error struct {
-	Code    int
-	Message string
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
+// writeHttpResponse sends the error as {"error": {"code", "message"}}.
 func (e *Error) writeHttpResponse(w http.ResponseWriter) {
-	http.Error(w, e.Message, e.Code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code)
+	json.NewEncoder(w).Encode(struct {
+		Error Error `json:"error"`
+	}{*e})
 }
 
 var (
 	database            *mongo.Database
-	existingCollections []string
+	existingCollections = newCollectionCache(defaultMaxCachedCollections)
 	pageRegex           = regexp.MustCompile(`page=[0-9]*`)
 
+	// debugMode enables endpoints exposing internals, like query plans
+	debugMode bool
+	// exposeMongoID includes the storage _id of videos in responses
+	exposeMongoID bool
+	// basePath is the path prefix the server is reached at behind a proxy, eg: /api
+	basePath string
+	// textLanguage is the $language of search queries, the worker's TEXT_INDEX_LANGUAGE
+	textLanguage string
+
 	internalError = Error{http.StatusInternalServerError, "Internal error"}
+	notFoundError = Error{http.StatusNotFound, "Not found"}
 )
 
-// TODO: Don't duplicate, import
+// Video is a stored video with what the server computes per request.
 type Video struct {
-	ID           primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	YoutubeID    string             `json:"youtubeId,omitempty" bson:"youtubeId,omitempty"`
-	Title        string             `json:"title,omitempty" bson:"title,omitempty"`
-	Description  string             `json:"description,omitempty" bson:"description,omitempty"`
-	PublishedAt  time.Time          `json:"publishedAt,omitempty" bson:"publishedAt,omitempty"`
-	ThumbnailUrl string             `json:"thumbnailUrl,omitempty" bson:"thumbnailUrl,omitempty"`
+	model.Video `bson:",inline"`
+
+	// Seconds since publishedAt at request time, only computed when requested with ?age=true
+	Age *int64 `json:"age,omitempty" bson:"-"`
+	// Text search relevance, only set when requested with ?search=
+	Score float64 `json:"score,omitempty" bson:"score,omitempty"`
+	// The thumbnails as an img srcset, only computed when requested with ?srcset=true
+	Srcset string `json:"srcset,omitempty" bson:"-"`
+}
+
+// videoFields is Video without its MarshalJSON, so videoJSON can embed it.
+type videoFields Video
+
+// videoJSON is the JSON form of a Video. Its ID shadows the embedded one so
+// the mongo _id is only sent when EXPOSE_MONGO_ID=true, clients identify
+// videos by youtubeId.
+type videoJSON struct {
+	videoFields
+	ID *primitive.ObjectID `json:"_id,omitempty"`
+}
+
+func (v Video) toJSON() videoJSON {
+	out := videoJSON{videoFields: videoFields(v)}
+	if exposeMongoID {
+		out.ID = &v.ID
+	}
+	return out
+}
+
+func (v Video) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.toJSON())
+}
+
+func (v *Video) setAge(now time.Time) {
+	age := int64(now.Sub(v.PublishedAt) / time.Second)
+	v.Age = &age
 }
 
-func setupDatabaseConnection(ctx context.Context, mongoUri, mongoDbName string) {
-	mongoOptions := options.Client().ApplyURI(mongoUri)
+// wantsAge reports whether the request asked for computed ages. As the age
+// changes with time such responses are marked as not cacheable.
+func wantsAge(w http.ResponseWriter, q url.Values) bool {
+	if q.Get("age") != "true" {
+		return false
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	return true
+}
+
+func setupDatabaseConnection(ctx context.Context, mongoUri, mongoDbName string, readPreference *readpref.ReadPref) {
+	mongoOptions := mongoenv.ClientOptions(mongoUri).SetReadPreference(readPreference)
 	mongoClient, err := mongo.Connect(ctx, mongoOptions)
 	if err != nil {
 		log.Fatalf("Error: Mongo connection failed: %v", err)
 	}
 
-	err = mongoClient.Ping(ctx, nil)
+	err = mongoClient.Ping(ctx, readPreference)
 	if err != nil {
 		log.Fatalf("Error: Database ping failed: %v", err)
 	}
@@ -71,69 +143,414 @@ type videosResponseMsg struct {
 	Result []Video `json:"result"`
 	Prev   string  `json:"prev"`
 	Next   string  `json:"next"`
+	// Videos matching the request's filters over all pages, unless ?count=false
+	Total      *int64 `json:"total,omitempty"`
+	TotalPages *int64 `json:"totalPages,omitempty"`
 }
 
-func keywordExistsIn(keyword string, list []string) bool {
-	// TODO: optimise this search
-	for _, c := range list {
-		if c == keyword {
-			return true
-		}
+// collectionExists reports whether there's a collection with name, or with
+// STORAGE_MODE=shared videos tagged with it.
+func collectionExists(ctx context.Context, name string) (bool, *Error) {
+	if existingCollections.contains(name) {
+		return true, nil
 	}
-	return false
+	// Not cached, or evicted. Check with the db in case it was added since
+	exists, err := keywordStored(ctx, name)
+	if err != nil {
+		log.Printf("Error: Unable to check if %s is stored: %v", name, err)
+		return false, &internalError
+	}
+	if exists {
+		existingCollections.add(name)
+		return true, nil
+	}
+	return false, nil
 }
 
-// validateKeyword ensures the relevant collection exists.
-func validateKeyword(ctx context.Context, keyword string) *Error {
-	if keywordExistsIn(keyword, existingCollections) {
-		return nil
+// validateKeyword ensures the relevant collection exists and returns its
+// name. Keywords that aren't collections themselves are looked up in model.AliasesCollection.
+func validateKeyword(ctx context.Context, keyword string) (string, *Error) {
+	name, nameErr := model.ValidateCollectionName(keyword)
+	if nameErr != nil {
+		return "", &Error{http.StatusBadRequest, fmt.Sprintf("Invalid keyword %q: %v", keyword, nameErr)}
 	}
-	collections, err := database.ListCollectionNames(ctx, bson.D{})
+	exists, err := collectionExists(ctx, name)
 	if err != nil {
-		log.Println("Error: Unable to get list of collections")
-		return &internalError
+		return "", err
 	}
-	existingCollections = collections
-	if keywordExistsIn(keyword, existingCollections) {
-		return nil
+	if exists {
+		return name, nil
 	}
-	return &Error{http.StatusBadRequest, fmt.Sprintf("Videos for %s are not being collected", keyword)}
-}
 
-func getVideos(w http.ResponseWriter, r *http.Request) {
-	keyword := r.URL.Path[len("/videos/"):]
-	if err := validateKeyword(r.Context(), keyword); err != nil {
-		err.writeHttpResponse(w)
-		return
+	collection, err := resolveAlias(ctx, name)
+	if err != nil {
+		return "", err
 	}
+	if collection != "" {
+		exists, err = collectionExists(ctx, collection)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return collection, nil
+		}
+	}
+	return "", &Error{http.StatusBadRequest, fmt.Sprintf("Videos for %s are not being collected", keyword)}
+}
 
-	q := r.URL.Query()
+// parsePagination reads the page and limit query params, falling back to defaults
+// for invalid ones and capping limit at maxLimit.
+func parsePagination(q url.Values) (page, limit int) {
 	page, err := strconv.Atoi(q.Get("page"))
-	if err != nil {
+	if err != nil || page < 0 {
 		page = 0
 	}
 
-	limit, err := strconv.Atoi(q.Get("limit"))
-	if err != nil {
+	limit, err = strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
 		limit = defaultLimit
 	}
 	if limit > maxLimit {
-		log.Printf("Error: limit exceeded")
+		limit = maxLimit
 	}
+	return page, limit
+}
 
-	search := q.Get("search")
+// parseWithin parses a positive duration of at most maxWithin, like
+// time.ParseDuration but also accepting whole days, eg: 7d.
+func parseWithin(within string) (time.Duration, error) {
+	var d time.Duration
+	if days := strings.TrimSuffix(within, "d"); days != within {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", within)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(within)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if d <= 0 || d > maxWithin {
+		return 0, fmt.Errorf("duration %q must be positive and at most %dd", within, maxWithin/(24*time.Hour))
+	}
+	return d, nil
+}
 
-	skip := page * limit
-	// limit+1, so we know if next exists
-	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit + 1)).SetSort(bson.D{{"publishedAt", -1}})
+// videosFilter builds the mongo filter shared by all listing endpoints.
+func videosFilter(q url.Values) (bson.D, *Error) {
 	filter := bson.D{}
-	if search != "" {
+	if search := q.Get("search"); search != "" {
 		// Question: Should this be full search?
-		filter = bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: search}}}}
+		text := bson.D{{Key: "$search", Value: search}}
+		if textLanguage != "" {
+			// Stemmed and stop worded like the index was built
+			text = append(text, bson.E{Key: "$language", Value: textLanguage})
+		}
+		filter = bson.D{{Key: "$text", Value: text}}
+	}
+	if source := q.Get("source"); source != "" {
+		filter = append(filter, bson.E{Key: "source", Value: source})
+	}
+	switch q.Get("live") {
+	case "true":
+		filter = append(filter, bson.E{Key: "liveBroadcastContent", Value: "live"})
+	case "false":
+		filter = append(filter, bson.E{Key: "liveBroadcastContent", Value: bson.D{{Key: "$ne", Value: "live"}}})
+	}
+	switch q.Get("hasStats") {
+	case "true":
+		filter = append(filter, bson.E{Key: "enriched", Value: true})
+	case "false":
+		// Videos stored before statistics were fetched have no enriched field
+		filter = append(filter, bson.E{Key: "enriched", Value: bson.D{{Key: "$ne", Value: true}}})
+	}
+	published, err := publishedRange(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(published) != 0 {
+		filter = append(filter, bson.E{Key: "publishedAt", Value: published})
+	}
+	return filter, nil
+}
+
+// publishedRange builds the publishedAt bounds of the within, publishedAfter
+// and publishedBefore params. within and publishedAfter both being set keeps
+// the later of the two.
+func publishedRange(q url.Values) (bson.D, *Error) {
+	var after, before time.Time
+	if within := q.Get("within"); within != "" {
+		d, err := parseWithin(within)
+		if err != nil {
+			return nil, &Error{http.StatusBadRequest, fmt.Sprintf("Invalid within: %v", err)}
+		}
+		after = time.Now().Add(-d)
+	}
+	if v := q.Get("publishedAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, &Error{http.StatusBadRequest, "publishedAfter must be an RFC 3339 time, eg: 2023-01-02T15:04:05Z"}
+		}
+		if t.After(after) {
+			after = t
+		}
+	}
+	if v := q.Get("publishedBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, &Error{http.StatusBadRequest, "publishedBefore must be an RFC 3339 time, eg: 2023-01-02T15:04:05Z"}
+		}
+		before = t
+	}
+	if !after.IsZero() && !before.IsZero() && after.After(before) {
+		return nil, &Error{http.StatusBadRequest, "publishedAfter must not be later than publishedBefore"}
+	}
+
+	published := bson.D{}
+	if !after.IsZero() {
+		published = append(published, bson.E{Key: "$gte", Value: after})
+	}
+	if !before.IsZero() {
+		published = append(published, bson.E{Key: "$lte", Value: before})
+	}
+	return published, nil
+}
+
+// pageURL returns the request's absolute url with the page query param set to page.
+func pageURL(r *http.Request, page int) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	return requestURL(r, q)
+}
+
+// cursorURL returns the request's absolute url for the page after last, in
+// the keyset form of ?mode=cursor.
+func cursorURL(r *http.Request, last Video) string {
+	q := r.URL.Query()
+	q.Del("page")
+	q.Set("after", last.PublishedAt.Format(time.RFC3339Nano))
+	q.Set("afterId", last.ID.Hex())
+	return requestURL(r, q)
+}
+
+// requestURL returns the request's absolute url with its query replaced by q.
+func requestURL(r *http.Request, q url.Values) string {
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	// Handlers see the path with basePath stripped
+	u.Path = basePath + u.Path
+	if u.RawPath != "" {
+		u.RawPath = basePath + u.RawPath
+	}
+	u.Scheme = requestScheme(r)
+	u.Host = r.Host
+	return u.String()
+}
+
+// requestScheme is the scheme the client used, which is the proxy's
+// X-Forwarded-Proto when the server is behind one.
+func requestScheme(r *http.Request) string {
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	switch proto = strings.ToLower(strings.TrimSpace(proto)); proto {
+	case "http", "https":
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// keywordHandler handles requests for the keyword from the request path.
+type keywordHandler func(w http.ResponseWriter, r *http.Request, keyword string)
+
+// splitVideosPath returns the keyword and sub resource of a /videos/ path.
+// They're split before being decoded, so a keyword can contain an encoded /.
+func splitVideosPath(r *http.Request) (keyword, resource string, err *Error) {
+	escapedKeyword, escapedResource, _ := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), "/videos/"), "/")
+	keyword, keywordErr := url.PathUnescape(escapedKeyword)
+	resource, resourceErr := url.PathUnescape(escapedResource)
+	if keywordErr != nil || resourceErr != nil {
+		return "", "", &Error{http.StatusBadRequest, "Invalid percent-encoding in path"}
+	}
+	return keyword, resource, nil
+}
+
+// videosHandler routes /videos/{keyword} and the keyword's sub resources.
+func videosHandler(w http.ResponseWriter, r *http.Request) {
+	keyword, resource, pathErr := splitVideosPath(r)
+	if pathErr != nil {
+		pathErr.writeHttpResponse(w)
+		return
+	}
+	methods := readMethods
+	if resource == "" {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodDelete}
+	}
+	if !allowMethods(w, r, methods...) {
+		return
 	}
+	switch resource {
+	case "":
+		switch r.Method {
+		case http.MethodDelete:
+			requireAdmin(deleteVideos)(w, r, keyword)
+		case http.MethodHead:
+			headVideos(w, r, keyword)
+		default:
+			getVideos(w, r, keyword)
+		}
+	case "count":
+		getCount(w, r, keyword)
+	case "suggest":
+		getSuggestions(w, r, keyword)
+	case "diagnostics":
+		requireAdmin(getDiagnostics)(w, r, keyword)
+	case "dump":
+		requireAdmin(getDump)(w, r, keyword)
+	default:
+		if !model.IsYoutubeID(resource) {
+			notFoundError.writeHttpResponse(w)
+			return
+		}
+		getVideo(w, r, keyword, resource)
+	}
+}
 
-	collection := database.Collection(keyword)
-	cursor, err := collection.Find(r.Context(), filter, findOptions)
+func getVideos(w http.ResponseWriter, r *http.Request, keyword string) {
+	keyword, keywordErr := validateKeyword(r.Context(), keyword)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+
+	q := r.URL.Query()
+	page, limit := parsePagination(q)
+
+	skip := page * limit
+	filter, filterErr := videosFilter(q)
+	if filterErr != nil {
+		filterErr.writeHttpResponse(w)
+		return
+	}
+	filter = append(keywordFilter(keyword), filter...)
+
+	cursorMode := q.Get("mode") == "cursor"
+	order := videosSort(q, cursorMode)
+	sortOrder := bson.D{{Key: "publishedAt", Value: -1}}
+	switch order {
+	case "oldest":
+		sortOrder = bson.D{{Key: "publishedAt", Value: 1}}
+	case "relevance":
+		sortOrder = bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}, {Key: "publishedAt", Value: -1}}
+	case "velocity":
+		sortOrder = velocitySort
+	}
+	if cursorMode {
+		// _id breaks ties between videos published at the same time
+		sortOrder = append(sortOrder, bson.E{Key: "_id", Value: sortOrder[0].Value})
+	}
+
+	collection := videosCollection(keyword)
+	if youtubeID := q.Get("newer_than_id"); youtubeID != "" {
+		if cursorMode {
+			(&Error{http.StatusBadRequest, "newer_than_id can't be used with mode=cursor"}).writeHttpResponse(w)
+			return
+		}
+		newer, err := newerThanFilter(r.Context(), collection, keyword, youtubeID)
+		if err != nil {
+			err.writeHttpResponse(w)
+			return
+		}
+		filter = append(filter, newer...)
+		sortOrder = bson.D{{Key: "publishedAt", Value: 1}, {Key: "_id", Value: 1}}
+	}
+	// The total covers all pages, not just the ones after the cursor
+	countFilter := filter
+	if cursorMode && q.Get("after") != "" {
+		after, err := afterFilter(q, order == "oldest")
+		if err != nil {
+			err.writeHttpResponse(w)
+			return
+		}
+		filter = append(bson.D{}, filter...)
+		filter = append(filter, after...)
+		skip = 0
+	}
+	projection, projectionErr := fieldsProjection(q)
+	if projectionErr != nil {
+		projectionErr.writeHttpResponse(w)
+		return
+	}
+	if debugMode && q.Get("explain") == "true" {
+		writeExplain(r.Context(), w, collection.Name(), filter, sortOrder, skip, limit+1)
+		return
+	}
+	// Counted lists get the ETag HEAD sends too, of the videos matching the
+	// filters rather than of the page, so a 304 skips querying the page
+	counted := q.Get("count") != "false"
+	var total int64
+	if counted {
+		var newest time.Time
+		var metaErr error
+		total, newest, metaErr = listMetadata(r.Context(), collection, q, countFilter)
+		if metaErr != nil {
+			internalError.writeHttpResponse(w)
+			return
+		}
+		if notModified(w, r, listETag(r, videosContentType(r), total, newest)) {
+			return
+		}
+	}
+	// limit videos and one more, to know if next exists, plus a few spare so
+	// documents that fail to decode don't eat into the page. The limit lets
+	// mongo stop sorting at the top ones, the cursor is closed once the page is
+	// full, so a first batch of limit+1 usually covers it.
+	var cursor *mongo.Cursor
+	var err error
+	// newer_than_id replaces the velocity order with its own
+	byVelocity := sortOrder[0].Key == "velocity"
+	atlas := useAtlasSearch(q)
+	if atlas {
+		var pipeline mongo.Pipeline
+		if byVelocity {
+			pipeline = velocityPipeline(atlasSearchStages(q.Get("search"), filter), "searchScore", projection, time.Now(), skip, limit+1)
+		} else {
+			pipeline = atlasSearchPipeline(q.Get("search"), filter, sortOrder, skip, limit+1)
+			if projection != nil {
+				pipeline = append(pipeline, bson.D{{Key: "$project", Value: append(projection, bson.E{Key: "score", Value: 1})}})
+			}
+		}
+		cursor, err = collection.Aggregate(r.Context(), pipeline)
+		if isSearchUnsupported(err) {
+			fallBackToText(err)
+			atlas = false
+		}
+	}
+	if !atlas && byVelocity {
+		scoreMeta := ""
+		if q.Get("search") != "" {
+			scoreMeta = "textScore"
+		}
+		match := mongo.Pipeline{{{Key: "$match", Value: filter}}}
+		cursor, err = collection.Aggregate(r.Context(), velocityPipeline(match, scoreMeta, projection, time.Now(), skip, limit+1))
+	} else if !atlas {
+		findOptions := options.Find().
+			SetSkip(int64(skip)).
+			SetLimit(int64(limit + 1 + undecodableSlack)).
+			SetBatchSize(int32(limit + 1)).
+			SetSort(sortOrder)
+		if q.Get("search") != "" {
+			projection = append(projection, scoreProjection...)
+		}
+		if projection != nil {
+			findOptions.SetProjection(projection)
+		}
+		cursor, err = collection.Find(r.Context(), filter, findOptions)
+	}
 	if err != nil {
 		log.Printf("Error: cannot get videos: %v", err)
 		internalError.writeHttpResponse(w)
@@ -143,22 +560,24 @@ func getVideos(w http.ResponseWriter, r *http.Request) {
 
 	var videos []Video
 	next := ""
-	i := 1
 	for cursor.Next(r.Context()) {
-		if i > limit {
-			nextReq := *r
-			q := nextReq.URL.Query()
-			q.Set("page", strconv.Itoa(page+1))
-			nextReq.URL.RawQuery = q.Encode()
-			next = nextReq.Host + nextReq.URL.String()
-		}
-		var v Video
-		if err := cursor.Decode(&v); err != nil {
+		v, err := decodeVideo(cursor)
+		if err != nil {
 			log.Println("Error: failed to decode result")
 			continue
 		}
+		if len(videos) == limit {
+			if cursorMode {
+				next = cursorURL(r, videos[len(videos)-1])
+			} else {
+				next = pageURL(r, page+1)
+			}
+			break
+		}
+		if err := v.DecompressDescription(); err != nil {
+			log.Printf("Error: failed to decompress description of %s: %v", v.YoutubeID, err)
+		}
 		videos = append(videos, v)
-		i++
 	}
 	response := videosResponseMsg{
 		Page:   page,
@@ -168,27 +587,502 @@ func getVideos(w http.ResponseWriter, r *http.Request) {
 	if next != "" {
 		response.Next = next
 	}
-	if page != 0 {
-		prevReq := *r
-		q := prevReq.URL.Query()
-		q.Set("page", strconv.Itoa(page-1))
-		prevReq.URL.RawQuery = q.Encode()
-		response.Prev = prevReq.Host + prevReq.URL.String()
+	if page != 0 && !cursorMode {
+		response.Prev = pageURL(r, page-1)
+	}
+	if counted {
+		totalPages := (total + int64(limit) - 1) / int64(limit)
+		response.Total, response.TotalPages = &total, &totalPages
+	}
+	if wantsAge(w, q) {
+		now := time.Now()
+		for i := range response.Result {
+			response.Result[i].setAge(now)
+		}
+	}
+	if q.Get("srcset") == "true" {
+		for i := range response.Result {
+			response.Result[i].Srcset = srcset(response.Result[i].Thumbnails)
+		}
+	}
+	contentType, body, err := encodeVideosResponse(r, &response)
+	if err != nil {
+		log.Printf("Error: cannot encode response: %v", err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	if !counted {
+		writeWithETag(w, r, contentType, body)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// afterFilter matches the videos after the after and afterId cursor params in
+// the publishedAt, _id order of ?mode=cursor, descending unless ascending.
+func afterFilter(q url.Values, ascending bool) (bson.D, *Error) {
+	after, err := time.Parse(time.RFC3339Nano, q.Get("after"))
+	if err != nil {
+		return nil, &Error{http.StatusBadRequest, "after must be an RFC 3339 time"}
+	}
+	op := "$lt"
+	if ascending {
+		op = "$gt"
+	}
+	// Within an $or, so it doesn't clash with the publishedAt range filters
+	beyond := bson.A{bson.D{{Key: "publishedAt", Value: bson.D{{Key: op, Value: after}}}}}
+	if afterID := q.Get("afterId"); afterID != "" {
+		id, err := primitive.ObjectIDFromHex(afterID)
+		if err != nil {
+			return nil, &Error{http.StatusBadRequest, "afterId must be a video _id"}
+		}
+		beyond = append(beyond, bson.D{{Key: "publishedAt", Value: after}, {Key: "_id", Value: bson.D{{Key: op, Value: id}}}})
+	}
+	return bson.D{{Key: "$or", Value: beyond}}, nil
+}
+
+// undecodableSlack is how many documents past a page are read, in case some
+// of the page fail to decode and are skipped.
+const undecodableSlack = 5
+
+// scoreProjection adds the text search relevance of each video as score,
+// keeping all the other fields.
+var scoreProjection = bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}}
+
+// videosSort reads the sort param: newest, the default, oldest, velocity, or
+// relevance when searching. Keyset pages can't follow relevance or velocity,
+// so they fall back to newest in cursor mode, as anything unrecognized does.
+func videosSort(q url.Values, cursorMode bool) string {
+	switch order := q.Get("sort"); order {
+	case "oldest":
+		return order
+	case "relevance":
+		if q.Get("search") != "" && !cursorMode {
+			return order
+		}
+	case "velocity":
+		if !cursorMode {
+			return order
+		}
+	}
+	return "newest"
+}
+
+// getVideo serves GET /videos/{keyword}/{youtubeId}: a single video.
+func getVideo(w http.ResponseWriter, r *http.Request, keyword, youtubeID string) {
+	keyword, keywordErr := validateKeyword(r.Context(), keyword)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+
+	filter := append(keywordFilter(keyword), bson.E{Key: "youtubeId", Value: youtubeID})
+	result := videosCollection(keyword).FindOne(r.Context(), filter)
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			(&Error{http.StatusNotFound, fmt.Sprintf("Video %s not found", youtubeID)}).writeHttpResponse(w)
+			return
+		}
+		log.Printf("Error: cannot get video %s: %v", youtubeID, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	v, err := decodeVideo(result)
+	if err != nil {
+		log.Printf("Error: cannot decode video %s: %v", youtubeID, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	if err := v.DecompressDescription(); err != nil {
+		log.Printf("Error: failed to decompress description of %s: %v", v.YoutubeID, err)
+	}
+	if wantsAge(w, r.URL.Query()) {
+		v.setAge(time.Now())
+	}
+	if r.URL.Query().Get("srcset") == "true" {
+		v.Srcset = srcset(v.Thumbnails)
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newerThanFilter matches the videos published after keyword's one with
+// youtubeID, using _id as a tiebreaker for videos published at the same time.
+func newerThanFilter(ctx context.Context, collection *mongo.Collection, keyword, youtubeID string) (bson.D, *Error) {
+	var ref Video
+	filter := append(keywordFilter(keyword), bson.E{Key: "youtubeId", Value: youtubeID})
+	err := collection.FindOne(ctx, filter).Decode(&ref)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, &Error{http.StatusBadRequest, fmt.Sprintf("Video %s not found", youtubeID)}
+	}
+	if err != nil {
+		log.Printf("Error: cannot get video %s: %v", youtubeID, err)
+		return nil, &internalError
+	}
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "publishedAt", Value: bson.D{{Key: "$gt", Value: ref.PublishedAt}}}},
+		bson.D{
+			{Key: "publishedAt", Value: ref.PublishedAt},
+			{Key: "_id", Value: bson.D{{Key: "$gt", Value: ref.ID}}},
+		},
+	}}}, nil
+}
+
+// writeExplain responds with the execution stats of the find query getVideos
+// would run, to check which indexes it uses.
+func writeExplain(ctx context.Context, w http.ResponseWriter, collection string, filter, sortOrder bson.D, skip, limit int) {
+	var plan bson.Raw
+	err := database.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: collection},
+			{Key: "filter", Value: filter},
+			{Key: "sort", Value: sortOrder},
+			{Key: "skip", Value: skip},
+			{Key: "limit", Value: limit},
+		}},
+		{Key: "verbosity", Value: "executionStats"},
+	}).Decode(&plan)
+	if err != nil {
+		log.Printf("Error: cannot explain query: %v", err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	body, err := bson.MarshalExtJSON(plan, false, false)
+	if err != nil {
+		log.Printf("Error: cannot encode query plan: %v", err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+type keywordVideo struct {
+	Video
+	Keyword string `json:"keyword"`
+}
+
+// MarshalJSON keeps the embedded Video's MarshalJSON from dropping Keyword.
+func (v keywordVideo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		videoJSON
+		Keyword string `json:"keyword"`
+	}{v.Video.toJSON(), v.Keyword})
+}
+
+type multiVideosResponseMsg struct {
+	Page   int            `json:"page"`
+	Limit  int            `json:"limit"`
+	Result []keywordVideo `json:"result"`
+	Prev   string         `json:"prev"`
+	Next   string         `json:"next"`
+}
+
+// getVideosMulti serves videos matching any of the comma separated keywords.
+func getVideosMulti(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var keywords []string
+	seen := map[string]bool{}
+	for _, k := range strings.Split(q.Get("keywords"), ",") {
+		k = strings.TrimSpace(k)
+		if k != "" && !seen[k] {
+			seen[k] = true
+			keywords = append(keywords, k)
+		}
+	}
+	if len(keywords) == 0 {
+		(&Error{http.StatusBadRequest, "keywords missing"}).writeHttpResponse(w)
+		return
+	}
+	if len(keywords) > maxKeywords {
+		(&Error{http.StatusBadRequest, fmt.Sprintf("At most %d keywords can be queried at once", maxKeywords)}).writeHttpResponse(w)
+		return
+	}
+	// Aliases of the same collection are only queried once
+	var collections []string
+	seen = map[string]bool{}
+	for _, keyword := range keywords {
+		collection, err := validateKeyword(r.Context(), keyword)
+		if err != nil {
+			err.writeHttpResponse(w)
+			return
+		}
+		if !seen[collection] {
+			seen[collection] = true
+			collections = append(collections, collection)
+		}
+	}
+
+	filter, err := videosFilter(q)
+	if err != nil {
+		err.writeHttpResponse(w)
+		return
+	}
+	writeMergedVideos(w, r, collections, filter)
+}
+
+// mergeNewestFirst sorts the videos of several keywords newest first, keeping
+// only the first keyword's copy of a video found in more than one.
+func mergeNewestFirst(merged []keywordVideo) []keywordVideo {
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].PublishedAt.After(merged[j].PublishedAt)
+	})
+
+	seen := make(map[string]struct{}, len(merged))
+	deduped := merged[:0]
+	for _, v := range merged {
+		if _, ok := seen[v.YoutubeID]; ok {
+			continue
+		}
+		seen[v.YoutubeID] = struct{}{}
+		deduped = append(deduped, v)
+	}
+	return deduped
+}
+
+// writeMergedVideos responds with a page of the videos matching filter in any
+// of the keywords' videos, newest first and de-duplicated by youtubeId.
+func writeMergedVideos(w http.ResponseWriter, r *http.Request, keywords []string, filter bson.D) {
+	q := r.URL.Query()
+	page, limit := parsePagination(q)
+	if page+1 > maxMergedOffset/limit {
+		(&Error{http.StatusBadRequest, fmt.Sprintf("page must end within the first %d videos", maxMergedOffset)}).writeHttpResponse(w)
+		return
+	}
+
+	// Duplicates are dropped only after merging, so skip can't be applied per
+	// collection. A video's position in the merged result is never lower than
+	// its position in its own collection, so the top (page+1)*limit+1 of each
+	// collection is enough to build this page and detect the next one.
+	want := (page+1)*limit + 1
+	findOptions := options.Find().SetLimit(int64(want)).SetSort(bson.D{{Key: "publishedAt", Value: -1}})
+	if q.Get("search") != "" {
+		findOptions.SetProjection(scoreProjection)
+	}
+
+	var merged []keywordVideo
+	for _, keyword := range keywords {
+		cursor, err := videosCollection(keyword).Find(r.Context(), append(keywordFilter(keyword), filter...), findOptions)
+		if err != nil {
+			log.Printf("Error: cannot get videos for %s: %v", keyword, err)
+			internalError.writeHttpResponse(w)
+			return
+		}
+		for cursor.Next(r.Context()) {
+			video, err := decodeVideo(cursor)
+			if err != nil {
+				log.Println("Error: failed to decode result")
+				continue
+			}
+			v := keywordVideo{Video: video, Keyword: keyword}
+			if err := v.DecompressDescription(); err != nil {
+				log.Printf("Error: failed to decompress description of %s: %v", v.YoutubeID, err)
+			}
+			merged = append(merged, v)
+		}
+		cursor.Close(r.Context())
+	}
+	deduped := mergeNewestFirst(merged)
+
+	var result []keywordVideo
+	hasNext := false
+	if skip := page * limit; skip < len(deduped) {
+		end := skip + limit
+		if end < len(deduped) {
+			hasNext = true
+		} else {
+			end = len(deduped)
+		}
+		result = deduped[skip:end]
+	}
+	writeKeywordVideos(w, r, page, limit, result, hasNext)
+}
+
+// writeKeywordVideos responds with a page of videos of several keywords, with
+// a next link when hasNext.
+func writeKeywordVideos(w http.ResponseWriter, r *http.Request, page, limit int, result []keywordVideo, hasNext bool) {
+	q := r.URL.Query()
+	response := multiVideosResponseMsg{
+		Page:   page,
+		Limit:  limit,
+		Result: result,
+	}
+	if hasNext {
+		response.Next = pageURL(r, page+1)
+	}
+	if page != 0 {
+		response.Prev = pageURL(r, page-1)
+	}
+	if wantsAge(w, q) {
+		now := time.Now()
+		for i := range response.Result {
+			response.Result[i].setAge(now)
+		}
+	}
+	if q.Get("srcset") == "true" {
+		for i := range response.Result {
+			response.Result[i].Srcset = srcset(response.Result[i].Thumbnails)
+		}
+	}
+	writeJSONWithETag(w, r, response)
 }
 
 func main() {
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://0.0.0.0:27017"
+	logging.Setup()
+	mongoURI, readPreference, err := readConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 	mongoDbName := os.Getenv("MONGO_DB")
 	if mongoDbName == "" {
 		log.Fatal("MONGO_DB missing")
 	}
-	setupDatabaseConnection(context.Background(), mongoURI, mongoDbName)
-	http.HandleFunc("/videos/", getVideos)
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	setupDatabaseConnection(context.Background(), mongoURI, mongoDbName, readPreference)
+	debugMode = os.Getenv("DEBUG") == "true"
+	sharedStorage = mongoenv.SharedStorage()
+	if n, err := strconv.Atoi(os.Getenv("MAX_CACHED_COLLECTIONS")); err == nil && n > 0 {
+		existingCollections = newCollectionCache(n)
+	}
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	exposeMongoID = os.Getenv("EXPOSE_MONGO_ID") == "true"
+	textLanguage = os.Getenv("TEXT_INDEX_LANGUAGE")
+	switch backend := os.Getenv("SEARCH_BACKEND"); backend {
+	case "", "text":
+	case "atlas":
+		atlasSearch = true
+	default:
+		log.Printf("SEARCH_BACKEND must be text or atlas. Defaulting to text")
+	}
+	if index := os.Getenv("ATLAS_SEARCH_INDEX"); index != "" {
+		atlasSearchIndex = index
+	}
+	if v := os.Getenv("ATLAS_SEARCH_MAX_EDITS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && (n == 1 || n == 2) {
+			atlasMaxEdits = n
+		} else {
+			log.Printf("ATLAS_SEARCH_MAX_EDITS must be 1 or 2. Defaulting to %d", defaultAtlasMaxEdits)
+		}
+	}
+	requestTimeout := defaultRequestTimeout
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			requestTimeout = time.Duration(n) * time.Second
+		} else {
+			log.Printf("REQUEST_TIMEOUT must be a number of seconds. Defaulting to %v", defaultRequestTimeout)
+		}
+	}
+	maxConcurrent := defaultMaxConcurrentRequests
+	if v := os.Getenv("MAX_CONCURRENT_REQUESTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			maxConcurrent = n
+		} else {
+			log.Printf("MAX_CONCURRENT_REQUESTS must be a number. Defaulting to %d", defaultMaxConcurrentRequests)
+		}
+	}
+	limit := requestLimiter(requestTimeout, maxConcurrent)
+	http.HandleFunc("/videos/", limit(videosHandler))
+	http.HandleFunc("/videos", limit(readOnly(getVideosMulti)))
+	http.HandleFunc("/channels/", readOnly(getChannelVideos))
+	http.HandleFunc("/keywords", readOnly(getKeywords))
+	http.HandleFunc("/healthz", readOnly(getHealth))
+	http.HandleFunc("/status", readOnly(getStatus))
+	http.HandleFunc("/openapi.json", readOnly(getOpenAPI))
+	// Unknown paths get a JSON 404 too, instead of the mux's plain text one
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		notFoundError.writeHttpResponse(w)
+	})
+
+	var handler http.Handler = http.DefaultServeMux
+	if l := limiterFromEnv(); l != nil {
+		handler = rateLimit(handler, l, parseTrustedProxies(os.Getenv("TRUSTED_PROXIES")))
+	}
+	if basePath = strings.TrimSuffix(os.Getenv("BASE_PATH"), "/"); basePath != "" {
+		if !strings.HasPrefix(basePath, "/") {
+			log.Fatalf("Error: BASE_PATH must start with /, got %s", basePath)
+		}
+		handler = stripBasePath(handler, basePath)
+	}
+	if os.Getenv("COMPRESS_RESPONSES") != "false" {
+		minSize := defaultGzipMinSize
+		if v := os.Getenv("GZIP_MIN_SIZE"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+				minSize = n
+			} else {
+				log.Printf("GZIP_MIN_SIZE must be a number of bytes. Defaulting to %d", defaultGzipMinSize)
+			}
+		}
+		handler = gzipResponses(handler, minSize)
+	}
+	if allowedOrigins := os.Getenv("ALLOWED_ORIGINS"); allowedOrigins != "" {
+		var origins []string
+		for _, o := range strings.Split(allowedOrigins, ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				origins = append(origins, o)
+			}
+		}
+		handler = allowCORS(handler, origins)
+	}
+	if os.Getenv("LOG_REQUESTS") != "false" {
+		handler = logRequests(handler)
+	}
+	shutdownTimeout := defaultShutdownTimeout
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			shutdownTimeout = time.Duration(n) * time.Second
+		} else {
+			log.Printf("SHUTDOWN_TIMEOUT must be a number of seconds. Defaulting to %v", defaultShutdownTimeout)
+		}
+	}
+	addr := listenAddr()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Error: cannot listen on %s: %v", addr, err)
+	}
+	log.Printf("Listening on %s", addr)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serve(ctx, &http.Server{Handler: handler}, l, shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readConfigFromEnv returns the uri and read preference the server reads
+// with. The server only reads, so MONGO_READ_URI can point it at other
+// members than the worker's MONGO_URI.
+func readConfigFromEnv() (string, *readpref.ReadPref, error) {
+	mongoURI := os.Getenv("MONGO_READ_URI")
+	if mongoURI == "" {
+		mongoURI = os.Getenv("MONGO_URI")
+	}
+	if mongoURI == "" {
+		mongoURI = "mongodb://0.0.0.0:27017"
+	}
+	readPreference := readpref.Primary()
+	if pref := os.Getenv("MONGO_READ_PREFERENCE"); pref != "" {
+		mode, err := readpref.ModeFromString(pref)
+		if err == nil {
+			readPreference, err = readpref.New(mode)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("Invalid MONGO_READ_PREFERENCE: %w", err)
+		}
+	}
+	return mongoURI, readPreference, nil
+}
+
+// listenAddr returns the address the server listens on: LISTEN_ADDR, else
+// all interfaces on PORT as set by platforms like Heroku or Cloud Run, else :8080.
+func listenAddr() string {
+	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
+		return addr
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			log.Printf("PORT must be a port number. Defaulting to 8080")
+		} else {
+			return ":" + port
+		}
+	}
+	return ":8080"
 }
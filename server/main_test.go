@@ -0,0 +1,701 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// unreachableDatabase points database at a mongo nobody listens on, so the
+// code paths that query it fail fast instead of needing a server.
+func unreachableDatabase(t *testing.T) {
+	t.Helper()
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := database
+	database = client.Database("test")
+	t.Cleanup(func() {
+		database = saved
+		client.Disconnect(context.Background())
+	})
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantPage  int
+		wantLimit int
+	}{
+		{"", 0, defaultLimit},
+		{"limit=1", 0, 1},
+		{"limit=49", 0, 49},
+		{"limit=50", 0, maxLimit},
+		{"limit=51", 0, maxLimit},
+		{"limit=500", 0, maxLimit},
+		{"limit=0", 0, defaultLimit},
+		{"limit=-1", 0, defaultLimit},
+		{"limit=ten", 0, defaultLimit},
+		{"page=3&limit=20", 3, 20},
+		{"page=-1", 0, defaultLimit},
+		{"page=last", 0, defaultLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, limit := parsePagination(q)
+			if page != tt.wantPage || limit != tt.wantLimit {
+				t.Errorf("parsePagination() = %d, %d, want %d, %d", page, limit, tt.wantPage, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestPageURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		basePath  string
+		tls       bool
+		forwarded string
+		want      string
+	}{
+		{"plain http", "/videos/cats?limit=5", "", false, "", "http://example.com/videos/cats?limit=5&page=2"},
+		{"tls", "/videos/cats", "", true, "", "https://example.com/videos/cats?page=2"},
+		{"proxied https", "/videos/cats", "", false, "https", "https://example.com/videos/cats?page=2"},
+		{"proxied over a chain", "/videos/cats", "", false, "HTTPS, http", "https://example.com/videos/cats?page=2"},
+		{"proxied http over tls", "/videos/cats", "", true, "http", "http://example.com/videos/cats?page=2"},
+		{"unknown forwarded scheme", "/videos/cats", "", false, "javascript", "http://example.com/videos/cats?page=2"},
+		{"base path", "/videos/cats?page=1", "/api", false, "", "http://example.com/api/videos/cats?page=2"},
+		{"encoded keyword", "/videos/machine%20learning", "", false, "", "http://example.com/videos/machine%20learning?page=2"},
+		{"encoded slash", "/videos/a%2Fb", "/api", false, "", "http://example.com/api/videos/a%2Fb?page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := basePath
+			defer func() { basePath = saved }()
+			basePath = tt.basePath
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.forwarded)
+			}
+
+			got := pageURL(r, 2)
+			if got != tt.want {
+				t.Errorf("pageURL() = %q, want %q", got, tt.want)
+			}
+			u, err := url.Parse(got)
+			if err != nil {
+				t.Fatalf("url.Parse(%q): %v", got, err)
+			}
+			if !u.IsAbs() || u.Host != "example.com" {
+				t.Errorf("%q isn't an absolute url of the request's host", got)
+			}
+		})
+	}
+}
+
+// The links used to be host and path only, which url.Parse takes as a
+// relative path, or rejects
+func TestPageURLParsesAsAbsolute(t *testing.T) {
+	tests := []struct {
+		link    string
+		wantAbs bool
+		wantErr bool
+	}{
+		{"example.com/videos/cats?page=1", false, false},
+		{"127.0.0.1:8080/videos/cats?page=1", false, true},
+		{"http://example.com/videos/cats?page=1", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			u, err := url.Parse(tt.link)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("url.Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && u.IsAbs() != tt.wantAbs {
+				t.Errorf("IsAbs() = %v, want %v", u.IsAbs(), tt.wantAbs)
+			}
+		})
+	}
+	r := httptest.NewRequest(http.MethodGet, "/videos/cats", nil)
+	r.Host = "example.com:8080"
+	if u, err := url.Parse(pageURL(r, 1)); err != nil || u.Host != "example.com:8080" {
+		t.Errorf("url.Parse(pageURL()) = %v, %v", u, err)
+	}
+}
+
+func TestSplitVideosPath(t *testing.T) {
+	tests := []struct {
+		target       string
+		wantKeyword  string
+		wantResource string
+	}{
+		{"/videos/cats", "cats", ""},
+		{"/videos/machine%20learning", "machine learning", ""},
+		{"/videos/c++", "c++", ""},
+		{"/videos/c%2B%2B/count", "c++", "count"},
+		{"/videos/%E6%97%A5%E6%9C%AC%E8%AA%9E", "日本語", ""},
+		{"/videos/日本語/suggest", "日本語", "suggest"},
+		{"/videos/a%2Fb/dump", "a/b", "dump"},
+		{"/videos/100%25/count", "100%", "count"},
+		{"/videos/cats/dQw4w9WgXcQ", "cats", "dQw4w9WgXcQ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			keyword, resource, err := splitVideosPath(r)
+			if err != nil {
+				t.Fatalf("splitVideosPath() error = %v", err)
+			}
+			if keyword != tt.wantKeyword || resource != tt.wantResource {
+				t.Errorf("splitVideosPath() = %q, %q, want %q, %q", keyword, resource, tt.wantKeyword, tt.wantResource)
+			}
+		})
+	}
+}
+
+func TestParseWithin(t *testing.T) {
+	tests := []struct {
+		within  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"24h", 24 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"365d", maxWithin, false},
+		{"366d", 0, true},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"0s", 0, true},
+		{"1.5d", 0, true},
+		{"d", 0, true},
+		{"1w", 0, true},
+		{"yesterday", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.within, func(t *testing.T) {
+			got, err := parseWithin(tt.within)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWithin(%q) error = %v, wantErr %v", tt.within, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseWithin(%q) = %v, want %v", tt.within, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishedRangeWithin(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantAfter  time.Duration
+		wantStatus int
+	}{
+		{"hours", "within=24h", 24 * time.Hour, 0},
+		{"days", "within=7d", 7 * 24 * time.Hour, 0},
+		{"later publishedAfter wins", "within=7d&publishedAfter=" + url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339)), time.Hour, 0},
+		{"later within wins", "within=24h&publishedAfter=2020-01-01T00:00:00Z", 24 * time.Hour, 0},
+		{"invalid", "within=soon", 0, http.StatusBadRequest},
+		{"negative", "within=-7d", 0, http.StatusBadRequest},
+		{"too long", "within=1000d", 0, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			published, err := publishedRange(q)
+			if tt.wantStatus != 0 {
+				if err == nil || err.Code != tt.wantStatus {
+					t.Fatalf("publishedRange() error = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(published) != 1 || published[0].Key != "$gte" {
+				t.Fatalf("publishedRange() = %v, want a single $gte bound", published)
+			}
+			after := published[0].Value.(time.Time)
+			// Allow for the RFC 3339 rounding and the time the test takes
+			if ago := time.Since(after); ago < tt.wantAfter-time.Second || ago > tt.wantAfter+time.Minute {
+				t.Errorf("publishedAt >= %v, %v ago; want %v ago", after, ago, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestFieldsProjectionMongoID(t *testing.T) {
+	defer func(expose bool) { exposeMongoID = expose }(exposeMongoID)
+
+	exposeMongoID = false
+	_, err := fieldsProjection(url.Values{"fields": {"_id"}})
+	if err == nil || err.Code != http.StatusBadRequest || err.Message != "Field _id is not exposed" {
+		t.Errorf("fields=_id without EXPOSE_MONGO_ID: error = %v, want 400 Field _id is not exposed", err)
+	}
+
+	exposeMongoID = true
+	projection, err := fieldsProjection(url.Values{"fields": {"_id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{{Key: "youtubeId", Value: 1}, {Key: "_id", Value: 1}}
+	if !reflect.DeepEqual(projection, want) {
+		t.Errorf("fields=_id with EXPOSE_MONGO_ID: projection = %v, want %v", projection, want)
+	}
+}
+
+func TestVideoJSONMongoID(t *testing.T) {
+	defer func(expose bool) { exposeMongoID = expose }(exposeMongoID)
+
+	id := primitive.NewObjectID()
+	doc, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "youtubeId", Value: "dQw4w9WgXcQ"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		expose   bool
+		fields   string
+		wantID   bool
+		wantCode int
+	}{
+		{"hidden by default", false, "", false, 0},
+		{"exposed when enabled", true, "", true, 0},
+		{"not selectable by default", false, "_id,title", false, http.StatusBadRequest},
+		{"selectable when enabled", true, "_id,title", true, 0},
+		{"selectable alone when enabled", true, "_id", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exposeMongoID = tt.expose
+			if tt.fields != "" {
+				_, err := fieldsProjection(url.Values{"fields": {tt.fields}})
+				if tt.wantCode != 0 {
+					if err == nil || err.Code != tt.wantCode {
+						t.Errorf("fieldsProjection(%q) error = %v, want status %d", tt.fields, err, tt.wantCode)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Decoding keeps the _id either way, only the JSON leaves it out
+			var v Video
+			if err := bson.Unmarshal(doc, &v); err != nil {
+				t.Fatal(err)
+			}
+			if v.ID != id {
+				t.Fatalf("decoded _id %v, want %v", v.ID, id)
+			}
+			body, err := json.Marshal(videosResponseMsg{Result: []Video{v}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp struct {
+				Result []map[string]interface{} `json:"result"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := resp.Result[0]["_id"]
+			if ok != tt.wantID {
+				t.Fatalf("_id in %s: %v, want %v", body, ok, tt.wantID)
+			}
+			if ok && got != id.Hex() {
+				t.Errorf("_id = %v, want %s", got, id.Hex())
+			}
+			if resp.Result[0]["youtubeId"] != "dQw4w9WgXcQ" {
+				t.Errorf("youtubeId missing from %s", body)
+			}
+		})
+	}
+}
+
+func TestVideoAge(t *testing.T) {
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		publishedAt time.Time
+		want        int64
+	}{
+		{"two days", now.Add(-48 * time.Hour), 172800},
+		{"just published", now, 0},
+		{"rounds down to seconds", now.Add(-1500 * time.Millisecond), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Video{Video: model.Video{YoutubeID: "dQw4w9WgXcQ", PublishedAt: tt.publishedAt}}
+			v.setAge(now)
+			b, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got struct {
+				Age *int64 `json:"age"`
+			}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Age == nil || *got.Age != tt.want {
+				t.Errorf("age = %v in %s, want %d", got.Age, b, tt.want)
+			}
+		})
+	}
+
+	b, _ := json.Marshal(Video{Video: model.Video{YoutubeID: "dQw4w9WgXcQ"}})
+	if strings.Contains(string(b), `"age"`) {
+		t.Errorf("age included without being asked for: %s", b)
+	}
+}
+
+func TestWantsAge(t *testing.T) {
+	tests := []struct {
+		query     string
+		want      bool
+		wantCache string
+	}{
+		{"age=true", true, "no-store"},
+		{"age=false", false, ""},
+		{"", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			w := httptest.NewRecorder()
+			if got := wantsAge(w, q); got != tt.want {
+				t.Errorf("wantsAge() = %v, want %v", got, tt.want)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestNewerThanFilter(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	defer func(shared bool) { sharedStorage = shared }(sharedStorage)
+
+	ref := bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "youtubeId", Value: "dQw4w9WgXcQ"},
+		{Key: "publishedAt", Value: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	tests := []struct {
+		name       string
+		shared     bool
+		found      bool
+		wantLookup bson.D
+		wantStatus int
+	}{
+		{"found", false, true, bson.D{{Key: "youtubeId", Value: "dQw4w9WgXcQ"}}, 0},
+		{"not found", false, false, bson.D{{Key: "youtubeId", Value: "dQw4w9WgXcQ"}}, http.StatusBadRequest},
+		{"found in shared storage", true, true, bson.D{{Key: "keywords", Value: "cats"}, {Key: "youtubeId", Value: "dQw4w9WgXcQ"}}, 0},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			sharedStorage = tt.shared
+			batch := []bson.D{}
+			if tt.found {
+				batch = append(batch, ref)
+			}
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.cats", mtest.FirstBatch, batch...))
+
+			filter, err := newerThanFilter(context.Background(), mt.Coll, "cats", "dQw4w9WgXcQ")
+			if lookup := mt.GetStartedEvent().Command.Lookup("filter"); !reflect.DeepEqual(lookup, bsonValue(t, tt.wantLookup)) {
+				mt.Errorf("looked the video up with %v, want %v", lookup, tt.wantLookup)
+			}
+			if tt.wantStatus != 0 {
+				if err == nil || err.Code != tt.wantStatus {
+					mt.Fatalf("error = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatal(err)
+			}
+			want := bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "publishedAt", Value: bson.D{{Key: "$gt", Value: ref[2].Value}}}},
+				bson.D{
+					{Key: "publishedAt", Value: ref[2].Value},
+					{Key: "_id", Value: bson.D{{Key: "$gt", Value: ref[0].Value}}},
+				},
+			}}}
+			if !reflect.DeepEqual(bsonValue(t, filter), bsonValue(t, want)) {
+				mt.Errorf("newerThanFilter() = %v, want %v", filter, want)
+			}
+		})
+	}
+}
+
+// bsonValue marshals v as a document, to compare it with the commands sent.
+func bsonValue(t *testing.T, v interface{}) bson.RawValue {
+	t.Helper()
+	doc, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bson.RawValue{Type: bsontype.EmbeddedDocument, Value: doc}
+}
+
+func TestGetVideosExplain(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	defer func(debug bool) { debugMode = debug }(debugMode)
+
+	tests := []struct {
+		name        string
+		debug       bool
+		wantCommand string
+		wantPlan    bool
+	}{
+		{"debug mode", true, "explain", true},
+		{"explain ignored outside debug mode", false, "find", false},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			existingCollections.add("cats")
+			debugMode = tt.debug
+
+			if tt.wantPlan {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(
+					bson.E{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "IXSCAN"}}}}},
+					bson.E{Key: "executionStats", Value: bson.D{{Key: "totalDocsExamined", Value: 11}}},
+				))
+			} else {
+				mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch))
+			}
+			r := httptest.NewRequest(http.MethodGet, "/videos/cats?explain=true&count=false&limit=10", nil)
+			w := httptest.NewRecorder()
+			getVideos(w, r, "cats")
+			if w.Code != http.StatusOK {
+				mt.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			e := mt.GetStartedEvent()
+			if e == nil || e.CommandName != tt.wantCommand {
+				mt.Fatalf("ran %v, want %s", e, tt.wantCommand)
+			}
+			if tt.wantPlan {
+				if got := e.Command.Lookup("explain", "limit").AsInt64(); got != 11 {
+					mt.Errorf("explained a limit of %d, want the 11 getVideos queries", got)
+				}
+			}
+			if got := strings.Contains(w.Body.String(), "queryPlanner"); got != tt.wantPlan {
+				mt.Errorf("response has a query plan: %v, want %v: %s", got, tt.wantPlan, w.Body)
+			}
+		})
+	}
+}
+
+// undecodableDocument is a video whose title string lacks its terminating
+// null byte, so it fails to decode even into a map.
+func undecodableDocument() bson.Raw {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendStringElement(doc, "title", "broken")
+	doc, _ = bsoncore.AppendDocumentEnd(doc, idx)
+	doc[len(doc)-2] = 'x'
+	return bson.Raw(doc)
+}
+
+func TestGetVideosUndecodable(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	video := func(id string) bson.Raw {
+		doc, err := bson.Marshal(bson.D{{Key: "youtubeId", Value: id}, {Key: "title", Value: id}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	bad := undecodableDocument()
+	tests := []struct {
+		name     string
+		limit    int
+		docs     []interface{}
+		want     []string
+		wantNext bool
+	}{
+		{"bad document in the middle, more pages", 2, []interface{}{video("a"), bad, video("b"), video("c")}, []string{"a", "b"}, true},
+		{"bad document in the middle, last page", 2, []interface{}{video("a"), bad, video("b")}, []string{"a", "b"}, false},
+		{"bad lookahead document", 2, []interface{}{video("a"), video("b"), bad}, []string{"a", "b"}, false},
+		{"bad lookahead then another video", 2, []interface{}{video("a"), video("b"), bad, video("c")}, []string{"a", "b"}, true},
+		{"several bad documents", 3, []interface{}{bad, video("a"), bad, bad, video("b"), video("c"), video("d")}, []string{"a", "b", "c"}, true},
+		{"only bad documents", 2, []interface{}{bad, bad}, nil, false},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			existingCollections.add("cats")
+
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, bson.D{{Key: "n", Value: int32(42)}}),
+				mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch),
+				bson.D{{Key: "ok", Value: 1}, {Key: "cursor", Value: bson.D{
+					{Key: "id", Value: int64(0)},
+					{Key: "ns", Value: "test.cats"},
+					{Key: "firstBatch", Value: bson.A(tt.docs)},
+				}}},
+			)
+			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/videos/cats?limit=%d", tt.limit), nil)
+			w := httptest.NewRecorder()
+			getVideos(w, r, "cats")
+			if w.Code != http.StatusOK {
+				mt.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			// After the count and the newest video of the ETag
+			events := mt.GetAllStartedEvents()
+			if got := events[len(events)-1].Command.Lookup("limit").AsInt64(); got != int64(tt.limit+1+undecodableSlack) {
+				mt.Errorf("find limit = %d, want %d", got, tt.limit+1+undecodableSlack)
+			}
+
+			var resp videosResponseMsg
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				mt.Fatal(err)
+			}
+			var got []string
+			for _, v := range resp.Result {
+				got = append(got, v.YoutubeID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				mt.Errorf("result = %v, want %v", got, tt.want)
+			}
+			if (resp.Next != "") != tt.wantNext {
+				mt.Errorf("next = %q, want next %v", resp.Next, tt.wantNext)
+			}
+			if resp.Total == nil || *resp.Total != 42 {
+				mt.Errorf("total = %v, want the count of 42", resp.Total)
+			}
+			if resp.Limit != tt.limit {
+				mt.Errorf("limit = %d, want %d", resp.Limit, tt.limit)
+			}
+		})
+	}
+}
+
+func TestGetVideosLimitCapped(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("limit=500", func(mt *mtest.T) {
+		savedDB, savedCollections := database, existingCollections
+		defer func() { database, existingCollections = savedDB, savedCollections }()
+		database = mt.DB
+		existingCollections = newCollectionCache(defaultMaxCachedCollections)
+		existingCollections.add("cats")
+
+		var docs bson.A
+		for i := 0; i < 2*maxLimit; i++ {
+			docs = append(docs, bson.D{{Key: "youtubeId", Value: fmt.Sprintf("video%d", i)}})
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, bson.D{{Key: "n", Value: int32(len(docs))}}),
+			mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch),
+			bson.D{{Key: "ok", Value: 1}, {Key: "cursor", Value: bson.D{
+				{Key: "id", Value: int64(0)},
+				{Key: "ns", Value: "test.cats"},
+				{Key: "firstBatch", Value: docs},
+			}}},
+		)
+		w := httptest.NewRecorder()
+		getVideos(w, httptest.NewRequest(http.MethodGet, "/videos/cats?limit=500", nil), "cats")
+		if w.Code != http.StatusOK {
+			mt.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		events := mt.GetAllStartedEvents()
+		if got := events[len(events)-1].Command.Lookup("limit").AsInt64(); got != int64(maxLimit+1+undecodableSlack) {
+			mt.Errorf("find limit = %d, want %d", got, maxLimit+1+undecodableSlack)
+		}
+
+		var resp videosResponseMsg
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			mt.Fatal(err)
+		}
+		if resp.Limit != maxLimit {
+			mt.Errorf("limit = %d, want %d", resp.Limit, maxLimit)
+		}
+		if len(resp.Result) != maxLimit {
+			mt.Errorf("got %d videos, want %d", len(resp.Result), maxLimit)
+		}
+		if resp.Next == "" {
+			mt.Error("no next page, want one for the videos past the limit")
+		}
+	})
+}
+
+func TestReadConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		readURI    string
+		uri        string
+		preference string
+		wantURI    string
+		wantMode   readpref.Mode
+		wantErr    bool
+	}{
+		{"defaults", "", "", "", "mongodb://0.0.0.0:27017", readpref.PrimaryMode, false},
+		{"worker's uri", "", "mongodb://primary:27017", "", "mongodb://primary:27017", readpref.PrimaryMode, false},
+		{"read uri", "mongodb://replica:27017", "mongodb://primary:27017", "", "mongodb://replica:27017", readpref.PrimaryMode, false},
+		{"secondary preferred", "", "", "secondaryPreferred", "mongodb://0.0.0.0:27017", readpref.SecondaryPreferredMode, false},
+		{"nearest", "", "", "nearest", "mongodb://0.0.0.0:27017", readpref.NearestMode, false},
+		{"invalid", "", "", "replica", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MONGO_READ_URI", tt.readURI)
+			t.Setenv("MONGO_URI", tt.uri)
+			t.Setenv("MONGO_READ_PREFERENCE", tt.preference)
+			uri, pref, err := readConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if uri != tt.wantURI || pref.Mode() != tt.wantMode {
+				t.Errorf("readConfigFromEnv() = %s, %v, want %s, %v", uri, pref.Mode(), tt.wantURI, tt.wantMode)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+var methodNotAllowedError = Error{http.StatusMethodNotAllowed, "Method not allowed"}
+
+// readMethods are the methods of the endpoints only serving data.
+var readMethods = []string{http.MethodGet, http.MethodHead}
+
+// allowMethods reports whether r uses one of methods, and otherwise responds
+// 405 with an Allow header listing them.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	methodNotAllowedError.writeHttpResponse(w)
+	return false
+}
+
+// readOnly only lets GET and HEAD requests through to handler.
+func readOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if allowMethods(w, r, readMethods...) {
+			handler(w, r)
+		}
+	}
+}
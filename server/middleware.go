@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/hello/internal/logging"
+)
+
+// statusRecorder remembers the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// logRequests logs a line per request handled by next, with its method, path,
+// status, response size and duration.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		logging.Info("request", "method", r.Method, "path", r.URL.Path, "status", recorder.status,
+			"bytes", recorder.bytes, "duration_ms", float64(time.Since(start).Microseconds())/1000)
+	})
+}
+
+// stripBasePath serves the requests under prefix with next, with prefix
+// stripped, and the rest with a JSON 404 like any other unknown path.
+func stripBasePath(next http.Handler, prefix string) http.Handler {
+	stripped := http.StripPrefix(prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			notFoundError.writeHttpResponse(w)
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
+
+// corsMethods and corsHeaders are what cross origin requests may use, and
+// corsExposedHeaders the response headers their scripts may read besides the
+// safelisted ones.
+const (
+	corsMethods        = "GET, HEAD, DELETE, OPTIONS"
+	corsHeaders        = "Accept, Authorization, Content-Type"
+	corsExposedHeaders = "ETag, X-Total-Count"
+)
+
+// allowCORS lets pages from the origins call next, any origin with "*".
+// Preflight requests are answered without calling next.
+func allowCORS(next http.Handler, origins []string) http.Handler {
+	allowed := map[string]bool{}
+	for _, o := range origins {
+		allowed[o] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && (allowed["*"] || allowed[origin]) {
+			if allowed["*"] {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStripBasePath(t *testing.T) {
+	defer func(saved string) { basePath = saved }(basePath)
+	basePath = "/api"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/videos/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Next", pageURL(r, 1))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		notFoundError.writeHttpResponse(w)
+	})
+	handler := stripBasePath(mux, basePath)
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantPath string
+		wantNext string
+	}{
+		{"under the base path", "/api/videos/cats", http.StatusOK, "/videos/cats", "http://example.com/api/videos/cats?page=1"},
+		{"query kept", "/api/videos/cats?limit=5&page=3", http.StatusOK, "/videos/cats", "http://example.com/api/videos/cats?limit=5&page=1"},
+		{"unknown path under the base path", "/api/nothing", http.StatusNotFound, "", ""},
+		{"base path itself", "/api", http.StatusNotFound, "", ""},
+		{"outside the base path", "/videos/cats", http.StatusNotFound, "", ""},
+		{"base path as a name prefix", "/apis/videos/cats", http.StatusNotFound, "", ""},
+		{"root", "/", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				// The same JSON error as the rest of the API
+				var body struct {
+					Error Error `json:"error"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != tt.wantCode {
+					t.Errorf("body %q isn't a JSON %d error: %v", w.Body, tt.wantCode, err)
+				}
+				return
+			}
+			if got := w.Header().Get("X-Path"); got != tt.wantPath {
+				t.Errorf("routed as %q, want %q", got, tt.wantPath)
+			}
+			if got := w.Header().Get("X-Next"); got != tt.wantNext {
+				t.Errorf("link %q, want %q", got, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestAllowCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("X-Total-Count", "42")
+	})
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		origin      string
+		wantOrigin  string
+		wantExposed string
+		wantCode    int
+	}{
+		{"allowed origin", []string{"https://app.example.com"}, http.MethodGet, "https://app.example.com", "https://app.example.com", corsExposedHeaders, http.StatusOK},
+		{"any origin", []string{"*"}, http.MethodGet, "https://other.example.com", "*", corsExposedHeaders, http.StatusOK},
+		{"preflight", []string{"*"}, http.MethodOptions, "https://app.example.com", "*", corsExposedHeaders, http.StatusNoContent},
+		{"other origin", []string{"https://app.example.com"}, http.MethodGet, "https://evil.example.com", "", "", http.StatusOK},
+		{"same origin", []string{"*"}, http.MethodGet, "", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/videos/cats", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			w := httptest.NewRecorder()
+			allowCORS(next, tt.origins).ServeHTTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Errorf("status %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			exposed := w.Header().Get("Access-Control-Expose-Headers")
+			if exposed != tt.wantExposed {
+				t.Errorf("Access-Control-Expose-Headers = %q, want %q", exposed, tt.wantExposed)
+			}
+			if tt.wantExposed == "" || tt.wantCode != http.StatusOK {
+				return
+			}
+			// Scripts can read the pagination and caching headers
+			for _, h := range []string{"ETag", "X-Total-Count"} {
+				if !strings.Contains(exposed, h) || w.Header().Get(h) == "" {
+					t.Errorf("%s isn't exposed: %q", h, exposed)
+				}
+			}
+		})
+	}
+}
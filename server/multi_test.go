@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMergeNewestFirst(t *testing.T) {
+	at := func(hours int) time.Time {
+		return time.Date(2024, 5, 1, hours, 0, 0, 0, time.UTC)
+	}
+	video := func(keyword, id string, hours int) keywordVideo {
+		return keywordVideo{Video: Video{Video: model.Video{YoutubeID: id, PublishedAt: at(hours)}}, Keyword: keyword}
+	}
+	tests := []struct {
+		name string
+		// In the order the collections are queried, each newest first
+		videos []keywordVideo
+		want   []string
+	}{
+		{"single keyword", []keywordVideo{video("cats", "c2", 5), video("cats", "c1", 1)}, []string{"cats/c2", "cats/c1"}},
+		{
+			"interleaved keywords",
+			[]keywordVideo{video("cats", "c2", 6), video("cats", "c1", 2), video("dogs", "d2", 4), video("dogs", "d1", 1)},
+			[]string{"cats/c2", "dogs/d2", "cats/c1", "dogs/d1"},
+		},
+		{
+			"video in both keeps the first keyword's",
+			[]keywordVideo{video("cats", "both", 5), video("cats", "c1", 1), video("pets", "p1", 6), video("pets", "both", 5)},
+			[]string{"pets/p1", "cats/both", "cats/c1"},
+		},
+		{"none", nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, v := range mergeNewestFirst(tt.videos) {
+				got = append(got, v.Keyword+"/"+v.YoutubeID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeNewestFirst() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVideosMultiKeywordsParam(t *testing.T) {
+	tooMany := ""
+	for i := 0; i <= maxKeywords; i++ {
+		tooMany += "k" + strconv.Itoa(i) + ","
+	}
+	tests := []struct {
+		name     string
+		keywords string
+		want     int
+	}{
+		{"missing", "", http.StatusBadRequest},
+		{"only commas", " , ,", http.StatusBadRequest},
+		{"too many", tooMany, http.StatusBadRequest},
+		{"invalid keyword", "cats,bad$name", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/videos?keywords="+url.QueryEscape(tt.keywords), nil)
+			w := httptest.NewRecorder()
+			saved := existingCollections
+			defer func() { existingCollections = saved }()
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			existingCollections.add("cats")
+			getVideosMulti(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestWriteMergedVideosOffsetCap(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantLimit int64
+	}{
+		{"first page", "page=0&limit=50", http.StatusOK, 51},
+		{"last page within the cap", "page=19&limit=50", http.StatusOK, 1001},
+		{"uneven limit within the cap", "page=32&limit=30", http.StatusOK, 991},
+		{"page past the cap", "page=20&limit=50", http.StatusBadRequest, 0},
+		{"uneven limit past the cap", "page=33&limit=30", http.StatusBadRequest, 0},
+		{"default limit past the cap", "page=100", http.StatusBadRequest, 0},
+		{"huge page", "page=1000000&limit=50", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB, savedCollections := database, existingCollections
+			defer func() { database, existingCollections = savedDB, savedCollections }()
+			database = mt.DB
+			existingCollections = newCollectionCache(defaultMaxCachedCollections)
+			existingCollections.add("cats")
+			existingCollections.add("dogs")
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch),
+				mtest.CreateCursorResponse(0, "test.dogs", mtest.FirstBatch),
+			)
+
+			w := httptest.NewRecorder()
+			getVideosMulti(w, httptest.NewRequest(http.MethodGet, "/videos?keywords=cats,dogs&"+tt.query, nil))
+			if w.Code != tt.wantCode {
+				mt.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			events := mt.GetAllStartedEvents()
+			if tt.wantCode != http.StatusOK {
+				if len(events) != 0 {
+					mt.Errorf("ran %d queries for a rejected page", len(events))
+				}
+				return
+			}
+			if len(events) != 2 {
+				mt.Fatalf("ran %d queries, want one per keyword", len(events))
+			}
+			for _, e := range events {
+				if got := e.Command.Lookup("limit").AsInt64(); got != tt.wantLimit {
+					mt.Errorf("find on %s limited to %d, want %d", e.Command.Lookup("find"), got, tt.wantLimit)
+				}
+			}
+		})
+	}
+}
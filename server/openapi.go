@@ -0,0 +1,17 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes the server's endpoints. Keep it in sync with them.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// getOpenAPI serves GET /openapi.json, the OpenAPI 3 description of the API.
+func getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"example.com/hello/internal/model"
+	"example.com/hello/server/videospb"
+)
+
+const protobufContentType = "application/x-protobuf"
+
+func acceptsProtobuf(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), protobufContentType)
+}
+
+// videosContentType is what a videos list is sent to r as.
+func videosContentType(r *http.Request) string {
+	if acceptsProtobuf(r) {
+		return protobufContentType
+	}
+	return "application/json"
+}
+
+func (v *Video) toProto() *videospb.Video {
+	var id string
+	if exposeMongoID {
+		id = v.ID.Hex()
+	}
+	return &videospb.Video{
+		Id:           id,
+		YoutubeId:    v.YoutubeID,
+		Title:        v.Title,
+		Description:  v.Description,
+		PublishedAt:  timestamppb.New(v.PublishedAt),
+		ThumbnailUrl: v.ThumbnailUrl,
+		ChannelId:    v.ChannelID,
+		Age:          v.Age,
+		Source:       v.Source,
+
+		LiveBroadcastContent: v.LiveBroadcastContent,
+		RegionCode:           v.RegionCode,
+		ViewCount:            v.ViewCount,
+		LikeCount:            v.LikeCount,
+		CommentCount:         v.CommentCount,
+		Thumbnails:           thumbnailsToProto(v.Thumbnails),
+		Score:                v.Score,
+		Srcset:               v.Srcset,
+		FirstSeenAt:          timestampToProto(v.FirstSeenAt),
+		FetchWindowStart:     timestampToProto(v.FetchWindowStart),
+		FetchWindowEnd:       timestampToProto(v.FetchWindowEnd),
+	}
+}
+
+// timestampToProto leaves the times a video wasn't stored with unset.
+func timestampToProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func thumbnailsToProto(t *model.Thumbnails) *videospb.Thumbnails {
+	if t == nil {
+		return nil
+	}
+	return &videospb.Thumbnails{
+		Default:  thumbnailToProto(t.Default),
+		Medium:   thumbnailToProto(t.Medium),
+		High:     thumbnailToProto(t.High),
+		Standard: thumbnailToProto(t.Standard),
+		Maxres:   thumbnailToProto(t.Maxres),
+	}
+}
+
+func thumbnailToProto(t *model.Thumbnail) *videospb.Thumbnail {
+	if t == nil {
+		return nil
+	}
+	return &videospb.Thumbnail{Url: t.Url, Width: t.Width, Height: t.Height}
+}
+
+func (m *videosResponseMsg) toProto() *videospb.VideosResponse {
+	response := &videospb.VideosResponse{
+		Page:  int32(m.Page),
+		Limit: int32(m.Limit),
+		Prev:  m.Prev,
+		Next:  m.Next,
+
+		Total:      m.Total,
+		TotalPages: m.TotalPages,
+	}
+	for i := range m.Result {
+		response.Result = append(response.Result, m.Result[i].toProto())
+	}
+	return response
+}
+
+// encodeVideosResponse encodes response as protobuf for the clients that
+// accept it, JSON for the rest, and returns it with its content type.
+func encodeVideosResponse(r *http.Request, response *videosResponseMsg) (string, []byte, error) {
+	contentType := videosContentType(r)
+	if contentType == protobufContentType {
+		body, err := proto.Marshal(response.toProto())
+		return contentType, body, err
+	}
+	body, err := json.Marshal(response)
+	return contentType, append(body, '\n'), err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"example.com/hello/internal/model"
+	"example.com/hello/server/videospb"
+)
+
+func TestAcceptsProtobuf(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/x-protobuf", true},
+		{"application/json;q=0.5, application/x-protobuf", true},
+		{"*/*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/videos/cats", nil)
+			r.Header.Set("Accept", tt.accept)
+			if got := acceptsProtobuf(r); got != tt.want {
+				t.Errorf("acceptsProtobuf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteProtobufRoundTrip(t *testing.T) {
+	publishedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	firstSeenAt := publishedAt.Add(10 * time.Minute)
+	windowStart, windowEnd := publishedAt.Add(-time.Hour), publishedAt.Add(5*time.Minute)
+	age := int64(3600)
+	total := int64(21)
+	response := videosResponseMsg{
+		Page:  1,
+		Limit: 10,
+		Next:  "http://example.com/videos/cats?page=2",
+		Prev:  "http://example.com/videos/cats?page=0",
+		Total: &total,
+		Result: []Video{{
+			Video: model.Video{
+				YoutubeID:   "dQw4w9WgXcQ",
+				Title:       "Cats",
+				PublishedAt: publishedAt,
+				ChannelID:   "UCchannel",
+				ViewCount:   1000,
+				Thumbnails:  &model.Thumbnails{High: &model.Thumbnail{Url: "https://i.ytimg.com/hq.jpg", Width: 480, Height: 360}},
+				FirstSeenAt: &firstSeenAt,
+
+				FetchWindowStart: &windowStart,
+				FetchWindowEnd:   &windowEnd,
+			},
+			Age: &age,
+		}, {
+			Video: model.Video{YoutubeID: "9bZkp7q19f0", PublishedAt: publishedAt},
+		}},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/videos/cats?page=1", nil)
+	r.Header.Set("Accept", protobufContentType)
+	contentType, body, err := encodeVideosResponse(r, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != protobufContentType {
+		t.Errorf("Content-Type = %q, want %q", contentType, protobufContentType)
+	}
+	var got videospb.VideosResponse
+	if err := proto.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&got, response.toProto()) {
+		t.Errorf("decoded %v, want %v", &got, response.toProto())
+	}
+	if got.Page != 1 || got.Limit != 10 || got.Next != response.Next || got.GetTotal() != 21 || len(got.Result) != 2 {
+		t.Fatalf("decoded %v", &got)
+	}
+	v := got.Result[0]
+	if v.YoutubeId != "dQw4w9WgXcQ" || !v.PublishedAt.AsTime().Equal(publishedAt) || v.GetAge() != age ||
+		v.ViewCount != 1000 || v.Thumbnails.GetHigh().GetWidth() != 480 {
+		t.Errorf("decoded video %v", v)
+	}
+	if v.Id != "" {
+		t.Errorf("id %q sent without EXPOSE_MONGO_ID", v.Id)
+	}
+	if !v.FirstSeenAt.AsTime().Equal(firstSeenAt) || !v.FetchWindowStart.AsTime().Equal(windowStart) ||
+		!v.FetchWindowEnd.AsTime().Equal(windowEnd) {
+		t.Errorf("decoded firstSeenAt %v, fetch window %v to %v", v.FirstSeenAt, v.FetchWindowStart, v.FetchWindowEnd)
+	}
+	if untraced := got.Result[1]; untraced.FirstSeenAt != nil || untraced.FetchWindowStart != nil || untraced.FetchWindowEnd != nil {
+		t.Errorf("decoded %v, want the times it wasn't stored with unset", untraced)
+	}
+}
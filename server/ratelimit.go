@@ -0,0 +1,194 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRateLimit is the requests per second a client can make unless RATE_LIMIT is set
+	defaultRateLimit = 10
+	// defaultRateLimitBurst is how many requests a client can make at once unless RATE_LIMIT_BURST is set
+	defaultRateLimitBurst = 20
+	// bucketIdleTTL is how long a client's bucket is kept once it stopped making requests
+	bucketIdleTTL = 10 * time.Minute
+)
+
+var rateLimitedError = Error{http.StatusTooManyRequests, "Rate limit exceeded, retry later"}
+
+// limiter decides whether the client with key can make a request at now,
+// and if not, how long it should wait.
+type limiter interface {
+	allow(key string, now time.Time) (allowed bool, retryAfter time.Duration)
+}
+
+// tokenBucket is a limiter giving each client a bucket of burst tokens,
+// refilled at rate per second. Each request takes a token.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), buckets: map[string]*bucket{}}
+}
+
+func (l *tokenBucket) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets the clients idle for bucketIdleTTL, at most once per TTL, so
+// the buckets don't pile up.
+func (l *tokenBucket) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= bucketIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// trustedProxies are the networks of the proxies whose X-Forwarded-For is
+// believed, set by TRUSTED_PROXIES.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies reads a comma separated list of IPs and CIDRs, eg:
+// "10.0.0.0/8, 192.168.1.10". Invalid entries are logged and left out.
+func parseTrustedProxies(list string) trustedProxies {
+	var proxies trustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Error: Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
+
+func (p trustedProxies) contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP identifies the client of r: the connection's address, unless it's
+// a trusted proxy. Then it's the last address of X-Forwarded-For that isn't a
+// trusted proxy too, as the ones before it can be made up by the client.
+func clientIP(r *http.Request, proxies trustedProxies) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !proxies.contains(ip) {
+		return ip
+	}
+	addresses := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		forwarded := strings.TrimSpace(addresses[i])
+		if forwarded == "" {
+			break
+		}
+		ip = forwarded
+		if !proxies.contains(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// rateLimit responds 429 with Retry-After to the requests l doesn't allow,
+// and passes the others to next. Health checks aren't limited, so it has to
+// see the paths with BASE_PATH stripped.
+func rateLimit(next http.Handler, l limiter, proxies trustedProxies) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowed, retryAfter := l.allow(clientIP(r, proxies), time.Now()); !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			rateLimitedError.writeHttpResponse(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limiterFromEnv returns the limiter set by RATE_LIMIT and RATE_LIMIT_BURST,
+// nil when RATE_LIMIT=0 disables it.
+func limiterFromEnv() limiter {
+	rate := float64(defaultRateLimit)
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			log.Printf("RATE_LIMIT must be a number of requests per second. Defaulting to %d", defaultRateLimit)
+		} else {
+			rate = n
+		}
+	}
+	if rate == 0 {
+		return nil
+	}
+	burst := defaultRateLimitBurst
+	if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Printf("RATE_LIMIT_BURST must be at least 1. Defaulting to %d", defaultRateLimitBurst)
+		} else {
+			burst = n
+		}
+	}
+	return newTokenBucket(rate, burst)
+}
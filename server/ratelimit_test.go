@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"no proxy", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"spoofed header from untrusted client", "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:80", "198.51.100.1", "198.51.100.1"},
+		{"spoofed entry before trusted proxy", "10.1.2.3:80", "1.1.1.1, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:80", "198.51.100.1, 192.168.1.10, 10.9.9.9", "198.51.100.1"},
+		{"trusted proxy without header", "192.168.1.10:80", "", "192.168.1.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/videos/cats", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(r, proxies); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8, ::1, bogus, 192.168.1.10")
+	if len(proxies) != 3 {
+		t.Fatalf("got %d networks, want 3", len(proxies))
+	}
+	for _, ip := range []string{"10.200.0.1", "::1", "192.168.1.10"} {
+		if !proxies.contains(ip) {
+			t.Errorf("%s should be trusted", ip)
+		}
+	}
+	for _, ip := range []string{"192.168.1.11", "11.0.0.1", "not an ip"} {
+		if proxies.contains(ip) {
+			t.Errorf("%s shouldn't be trusted", ip)
+		}
+	}
+}
+
+func TestRateLimitSpoofedForwardedFor(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := rateLimit(ok, newTokenBucket(0.001, 1), nil)
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodGet, "/videos/cats", nil)
+		r.RemoteAddr = "203.0.113.5:1234"
+		r.Header.Set("X-Forwarded-For", "198.51.100."+strconv.Itoa(i+1))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("request %d: status %d, want %d", i, w.Code, want)
+		}
+	}
+}
+
+func TestRateLimitHealthzUnderBasePath(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/videos/", func(w http.ResponseWriter, r *http.Request) {})
+	handler := http.StripPrefix("/api", rateLimit(mux, newTokenBucket(0.001, 1), nil))
+
+	get := func(path string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 3; i++ {
+		if code := get("/api/healthz"); code != http.StatusOK {
+			t.Fatalf("health check %d: status %d, want 200", i, code)
+		}
+	}
+	if code := get("/api/videos/cats"); code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", code)
+	}
+	if code := get("/api/videos/cats"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want 429", code)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	l := newTokenBucket(1, 2)
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		if allowed, _ := l.allow("a", now); allowed != want {
+			t.Errorf("request %d: allowed %v, want %v", i, allowed, want)
+		}
+	}
+	if allowed, _ := l.allow("b", now); !allowed {
+		t.Error("other clients have their own bucket")
+	}
+	if allowed, _ := l.allow("a", now.Add(time.Second)); !allowed {
+		t.Error("the bucket refills at rate")
+	}
+}
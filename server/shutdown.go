@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultShutdownTimeout is how long in-flight requests get to complete on
+	// SIGTERM unless SHUTDOWN_TIMEOUT is set
+	defaultShutdownTimeout = 30 * time.Second
+	// streamStopTimeout is how long the requests still going after the
+	// shutdown timeout get to end their response once cancelled
+	streamStopTimeout = 5 * time.Second
+)
+
+// serve serves srv on l until ctx is done, then shuts it down: l stops
+// accepting and in-flight requests, like dumps, get timeout to complete.
+// The ones still going after that have their context cancelled, so streams
+// end their response cleanly instead of having the connection cut.
+func serve(ctx context.Context, srv *http.Server, l net.Listener, timeout time.Duration) error {
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	srv.BaseContext = func(net.Listener) context.Context { return requestsCtx }
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Serve(l) }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %v for in-flight requests", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	log.Printf("Requests still in flight after %v, cancelling them", timeout)
+	cancelRequests()
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), streamStopTimeout)
+	defer cancelStop()
+	if err := srv.Shutdown(stopCtx); errors.Is(err, context.DeadlineExceeded) {
+		return srv.Close()
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamLines writes a line every 10ms, lines of them or forever when it's
+// 0, and reports in the X-Dump-Complete trailer whether it got to the end,
+// like getDump.
+func streamLines(lines int, started chan<- struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Dump-Complete")
+		close(started)
+		for i := 0; lines == 0 || i < lines; i++ {
+			select {
+			case <-r.Context().Done():
+				w.Header().Set("X-Dump-Complete", "false")
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			io.WriteString(w, "{}\n")
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set("X-Dump-Complete", "true")
+	}
+}
+
+func TestServeShutdownDuringStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		lines        int
+		timeout      time.Duration
+		wantLines    int
+		wantComplete string
+	}{
+		{"stream completes within the timeout", 20, 5 * time.Second, 20, "true"},
+		{"stream cancelled after the timeout", 0, 50 * time.Millisecond, -1, "false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			started := make(chan struct{})
+			ctx, shutdown := context.WithCancel(context.Background())
+			defer shutdown()
+			served := make(chan error, 1)
+			go func() {
+				served <- serve(ctx, &http.Server{Handler: streamLines(tt.lines, started)}, l, tt.timeout)
+			}()
+
+			type result struct {
+				body     string
+				complete string
+				err      error
+			}
+			results := make(chan result, 1)
+			go func() {
+				resp, err := http.Get("http://" + l.Addr().String() + "/videos/cats/dump")
+				if err != nil {
+					results <- result{err: err}
+					return
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				results <- result{string(body), resp.Trailer.Get("X-Dump-Complete"), err}
+			}()
+
+			<-started
+			shutdown()
+			var res result
+			select {
+			case res = <-results:
+			case <-time.After(10 * time.Second):
+				t.Fatal("the response never ended")
+			}
+			if res.err != nil {
+				t.Fatalf("stream cut off: %v", res.err)
+			}
+			if res.complete != tt.wantComplete {
+				t.Errorf("X-Dump-Complete = %q, want %q", res.complete, tt.wantComplete)
+			}
+			if got := strings.Count(res.body, "\n"); tt.wantLines >= 0 && got != tt.wantLines {
+				t.Errorf("got %d lines, want %d", got, tt.wantLines)
+			}
+			if err := <-served; err != nil {
+				t.Errorf("serve() = %v", err)
+			}
+		})
+	}
+}
+
+func TestServeRefusesNewConnectionsOnShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, &http.Server{Handler: http.NotFoundHandler()}, l, time.Second)
+	}()
+	shutdown()
+	if err := <-served; err != nil {
+		t.Fatalf("serve() = %v", err)
+	}
+	if _, err := http.Get("http://" + l.Addr().String() + "/healthz"); err == nil {
+		t.Error("the server still accepts connections after shutting down")
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"example.com/hello/internal/model"
+)
+
+// srcset joins the thumbnail sizes that have a url and a width into an img
+// srcset, narrowest first, eg: "https://i.ytimg.com/vi/x/default.jpg 120w,
+// https://i.ytimg.com/vi/x/mqdefault.jpg 320w". It's empty when no size has
+// a width, like for videos stored before their sizes were.
+func srcset(thumbnails *model.Thumbnails) string {
+	if thumbnails == nil {
+		return ""
+	}
+	var sizes []*model.Thumbnail
+	for _, t := range []*model.Thumbnail{thumbnails.Default, thumbnails.Medium, thumbnails.High, thumbnails.Standard, thumbnails.Maxres} {
+		if t != nil && t.Url != "" && t.Width > 0 {
+			sizes = append(sizes, t)
+		}
+	}
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].Width < sizes[j].Width })
+	candidates := make([]string, len(sizes))
+	for i, t := range sizes {
+		candidates[i] = t.Url + " " + strconv.FormatInt(t.Width, 10) + "w"
+	}
+	return strings.Join(candidates, ", ")
+}
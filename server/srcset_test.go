@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"example.com/hello/internal/model"
+)
+
+func TestSrcset(t *testing.T) {
+	thumb := func(name string, width int64) *model.Thumbnail {
+		return &model.Thumbnail{Url: "https://i.ytimg.com/vi/x/" + name + ".jpg", Width: width}
+	}
+	tests := []struct {
+		name       string
+		thumbnails *model.Thumbnails
+		want       string
+	}{
+		{"none", nil, ""},
+		{
+			"all sizes",
+			&model.Thumbnails{
+				Default:  thumb("default", 120),
+				Medium:   thumb("mqdefault", 320),
+				High:     thumb("hqdefault", 480),
+				Standard: thumb("sddefault", 640),
+				Maxres:   thumb("maxresdefault", 1280),
+			},
+			"https://i.ytimg.com/vi/x/default.jpg 120w, https://i.ytimg.com/vi/x/mqdefault.jpg 320w, " +
+				"https://i.ytimg.com/vi/x/hqdefault.jpg 480w, https://i.ytimg.com/vi/x/sddefault.jpg 640w, " +
+				"https://i.ytimg.com/vi/x/maxresdefault.jpg 1280w",
+		},
+		{
+			"some sizes",
+			&model.Thumbnails{Default: thumb("default", 120), High: thumb("hqdefault", 480)},
+			"https://i.ytimg.com/vi/x/default.jpg 120w, https://i.ytimg.com/vi/x/hqdefault.jpg 480w",
+		},
+		{
+			"sizes without width are left out",
+			&model.Thumbnails{Default: thumb("default", 0), Medium: thumb("mqdefault", 320), High: &model.Thumbnail{Width: 480}},
+			"https://i.ytimg.com/vi/x/mqdefault.jpg 320w",
+		},
+		{
+			"narrowest first",
+			&model.Thumbnails{Default: thumb("wide", 640), Medium: thumb("narrow", 320)},
+			"https://i.ytimg.com/vi/x/narrow.jpg 320w, https://i.ytimg.com/vi/x/wide.jpg 640w",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := srcset(tt.thumbnails); got != tt.want {
+				t.Errorf("srcset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type termStatus struct {
+	Keyword         string    `json:"keyword" bson:"_id"`
+	LastFetchedTime time.Time `json:"lastFetchedTime" bson:"lastFetchedTime"`
+	// Seconds the worker currently waits between polls, 0 until it reports one
+	PollInterval int `json:"pollInterval" bson:"pollInterval"`
+	// Of the worker's last save, when it runs with RECORD_FETCH_TIMING=true
+	FetchTiming *model.FetchTimingStats `json:"fetchTiming,omitempty" bson:"fetchTiming,omitempty"`
+}
+
+type statusResponse struct {
+	Terms []termStatus `json:"terms"`
+	// Documents this server mapped field by field since it started, see decodeVideo
+	DecodeFailures int64 `json:"decodeFailures"`
+}
+
+// getStatus serves GET /status: how far the worker got and its current
+// polling interval, which ADAPTIVE_POLLING backs off while nothing is new,
+// and how many documents failed to decode.
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	cursor, err := database.Collection(model.StateCollection).Find(r.Context(), bson.D{},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Printf("Error: cannot read the worker state: %v", err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	terms := []termStatus{}
+	if err := cursor.All(r.Context(), &terms); err != nil {
+		log.Printf("Error: cannot decode the worker state: %v", err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statusResponse{Terms: terms, DecodeFailures: decodeFailures.Load()})
+}
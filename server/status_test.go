@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestDebugVarsNotServed checks nothing registers /debug/vars, or the like of
+// /debug/pprof, on the mux served to the public: expvar publishes the cmdline
+// and memstats there as soon as it's imported.
+func TestDebugVarsNotServed(t *testing.T) {
+	for _, path := range []string{"/debug/vars", "/debug/pprof/"} {
+		w := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestGetStatusDecodeFailures(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name     string
+		failures int64
+	}{
+		{"none", 0},
+		{"some", 3},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			savedDB := database
+			defer func() { database = savedDB }()
+			database = mt.DB
+			saved := decodeFailures.Swap(tt.failures)
+			defer decodeFailures.Store(saved)
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "test._state", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: "cats"}, {Key: "pollInterval", Value: 300}}))
+
+			w := httptest.NewRecorder()
+			getStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+			if w.Code != http.StatusOK {
+				mt.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp statusResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				mt.Fatal(err)
+			}
+			if resp.DecodeFailures != tt.failures {
+				mt.Errorf("decodeFailures = %d, want %d", resp.DecodeFailures, tt.failures)
+			}
+			if len(resp.Terms) != 1 || resp.Terms[0].Keyword != "cats" || resp.Terms[0].PollInterval != 300 {
+				mt.Errorf("terms = %+v, want cats polled every 300s", resp.Terms)
+			}
+		})
+	}
+}
+
+func TestGetStatusFetchTiming(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("timed", func(mt *mtest.T) {
+		savedDB := database
+		defer func() { database = savedDB }()
+		database = mt.DB
+		recordedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test._state", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: "cats"}, {Key: "fetchTiming", Value: bson.D{
+				{Key: "videos", Value: 2},
+				{Key: "avgLatencyMs", Value: int64(800)},
+				{Key: "maxLatencyMs", Value: int64(1200)},
+				{Key: "enrichedVideos", Value: 2},
+				{Key: "avgEnrichmentMs", Value: int64(300)},
+				{Key: "recordedAt", Value: recordedAt},
+			}}},
+			bson.D{{Key: "_id", Value: "dogs"}}))
+
+		w := httptest.NewRecorder()
+		getStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if w.Code != http.StatusOK {
+			mt.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var resp statusResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			mt.Fatal(err)
+		}
+		if len(resp.Terms) != 2 {
+			mt.Fatalf("terms = %+v, want cats and dogs", resp.Terms)
+		}
+		want := model.FetchTimingStats{Videos: 2, AvgLatencyMs: 800, MaxLatencyMs: 1200, EnrichedVideos: 2, AvgEnrichmentMs: 300, RecordedAt: recordedAt}
+		if got := resp.Terms[0].FetchTiming; got == nil || *got != want {
+			mt.Errorf("cats fetchTiming = %+v, want %+v", got, want)
+		}
+		if resp.Terms[1].FetchTiming != nil {
+			mt.Errorf("dogs fetchTiming = %+v, want none", resp.Terms[1].FetchTiming)
+		}
+		if strings.Count(w.Body.String(), "fetchTiming") != 1 {
+			mt.Errorf("body %s, want fetchTiming left out of untimed terms", w.Body)
+		}
+	})
+}
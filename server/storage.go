@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"example.com/hello/internal/mongoenv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sharedStorage is set with STORAGE_MODE=shared, when the worker stores the
+// videos of every keyword in mongoenv.SharedCollection tagged with their
+// keywords, instead of in a collection per keyword.
+var sharedStorage bool
+
+// videosCollection returns the collection holding the videos of keyword, the
+// name validateKeyword returned.
+func videosCollection(keyword string) *mongo.Collection {
+	if sharedStorage {
+		return database.Collection(mongoenv.SharedCollection)
+	}
+	return database.Collection(keyword)
+}
+
+// keywordFilter narrows the videosCollection of keyword down to its videos.
+// It's empty when keyword has a collection of its own.
+func keywordFilter(keyword string) bson.D {
+	if sharedStorage {
+		return bson.D{{Key: "keywords", Value: keyword}}
+	}
+	return bson.D{}
+}
+
+// keywordStored reports whether there are videos stored for keyword.
+func keywordStored(ctx context.Context, keyword string) (bool, error) {
+	if sharedStorage {
+		err := videosCollection(keyword).FindOne(ctx, keywordFilter(keyword),
+			options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 1}})).Err()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	collections, err := database.ListCollectionNames(ctx, bson.D{{Key: "name", Value: keyword}})
+	return len(collections) != 0, err
+}
+
+// storedKeywords returns the keywords of the shared collection.
+func storedKeywords(ctx context.Context) ([]string, error) {
+	values, err := database.Collection(mongoenv.SharedCollection).Distinct(ctx, "keywords", bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	keywords := make([]string, 0, len(values))
+	for _, v := range values {
+		if k, ok := v.(string); ok {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords, nil
+}
+
+// removeSharedKeyword untags the videos of keyword in the shared collection,
+// deleting the ones no other keyword found.
+func removeSharedKeyword(ctx context.Context, keyword string) error {
+	collection := videosCollection(keyword)
+	_, err := collection.UpdateMany(ctx, keywordFilter(keyword), bson.D{{Key: "$pull", Value: bson.D{{Key: "keywords", Value: keyword}}}})
+	if err != nil {
+		return fmt.Errorf("cannot untag videos: %w", err)
+	}
+	_, err = collection.DeleteMany(ctx, bson.D{{Key: "keywords", Value: bson.D{{Key: "$size", Value: 0}}}})
+	if err != nil {
+		return fmt.Errorf("cannot delete untagged videos: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestKeywordFilter(t *testing.T) {
+	defer func(shared bool) { sharedStorage = shared }(sharedStorage)
+
+	sharedStorage = false
+	if got := keywordFilter("cats"); len(got) != 0 {
+		t.Errorf("per collection filter = %v, want none", got)
+	}
+	sharedStorage = true
+	want := bson.D{{Key: "keywords", Value: "cats"}}
+	if got := keywordFilter("cats"); !reflect.DeepEqual(got, want) {
+		t.Errorf("shared filter = %v, want %v", got, want)
+	}
+	// Callers append to it, which mustn't leak into the next request's filter
+	first := append(keywordFilter("cats"), bson.E{Key: "youtubeId", Value: "a"})
+	second := keywordFilter("cats")
+	if len(second) != 1 || len(first) != 2 {
+		t.Errorf("filters share state: %v, %v", first, second)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 10
+	// maxSuggestPrefix bounds the length of the q param of suggestions
+	maxSuggestPrefix = 100
+)
+
+type suggestion struct {
+	YoutubeID string `json:"youtubeId" bson:"youtubeId"`
+	Title     string `json:"title" bson:"title"`
+}
+
+type suggestionsResponseMsg struct {
+	Suggestions []suggestion `json:"suggestions"`
+}
+
+// getSuggestions serves GET /videos/{keyword}/suggest?q=<prefix>: the titles
+// of up to limit videos starting with the prefix, newest first. With
+// SEARCH_BACKEND=atlas they come from an autocomplete index instead.
+func getSuggestions(w http.ResponseWriter, r *http.Request, keyword string) {
+	keyword, keywordErr := validateKeyword(r.Context(), keyword)
+	if keywordErr != nil {
+		keywordErr.writeHttpResponse(w)
+		return
+	}
+	q := r.URL.Query()
+	prefix := q.Get("q")
+	if prefix == "" || len(prefix) > maxSuggestPrefix {
+		(&Error{http.StatusBadRequest, "q must be a title prefix of 1 to 100 bytes"}).writeHttpResponse(w)
+		return
+	}
+	limit := defaultSuggestions
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > maxSuggestions {
+		limit = maxSuggestions
+	}
+
+	collection := videosCollection(keyword)
+	scope := keywordFilter(keyword)
+	var suggestions []suggestion
+	var err error
+	atlas := atlasSearch && !atlasUnavailable.Load()
+	if atlas {
+		suggestions, err = atlasSuggestions(r.Context(), collection, scope, prefix, limit)
+		if isSearchUnsupported(err) {
+			fallBackToText(err)
+			atlas = false
+		}
+	}
+	if !atlas {
+		suggestions, err = prefixSuggestions(r.Context(), collection, scope, prefix, limit)
+	}
+	if err != nil {
+		log.Printf("Error: cannot get suggestions for %s: %v", keyword, err)
+		internalError.writeHttpResponse(w)
+		return
+	}
+	if suggestions == nil {
+		suggestions = []suggestion{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestionsResponseMsg{Suggestions: suggestions})
+}
+
+var suggestionProjection = bson.D{{Key: "_id", Value: 0}, {Key: "youtubeId", Value: 1}, {Key: "title", Value: 1}}
+
+// prefixSuggestions matches titles starting with prefix, ignoring case. Going
+// newest first through the publishedAt index, it stops at limit matches.
+func prefixSuggestions(ctx context.Context, collection *mongo.Collection, scope bson.D, prefix string, limit int) ([]suggestion, error) {
+	filter := append(scope, bson.E{Key: "title", Value: primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix), Options: "i"}})
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "publishedAt", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(suggestionProjection)
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var suggestions []suggestion
+	err = cursor.All(ctx, &suggestions)
+	return suggestions, err
+}
+
+// atlasSuggestions matches titles with the autocomplete operator of Atlas
+// Search, which needs title mapped as autocomplete in the search index.
+func atlasSuggestions(ctx context.Context, collection *mongo.Collection, scope bson.D, prefix string, limit int) ([]suggestion, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$search", Value: bson.D{
+			{Key: "index", Value: atlasSearchIndex},
+			{Key: "autocomplete", Value: bson.D{{Key: "query", Value: prefix}, {Key: "path", Value: "title"}}},
+		}}},
+	}
+	if len(scope) != 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: scope}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$limit", Value: limit}},
+		bson.D{{Key: "$project", Value: suggestionProjection}},
+	)
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var suggestions []suggestion
+	err = cursor.All(ctx, &suggestions)
+	return suggestions, err
+}
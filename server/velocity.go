@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// velocityMinAgeHours floors the age views are divided by, so a video
+// published minutes ago doesn't top the ranking off a handful of views.
+const velocityMinAgeHours = 1
+
+// velocitySort orders by views per hour since publish, fastest first.
+var velocitySort = bson.D{{Key: "velocity", Value: -1}, {Key: "publishedAt", Value: -1}}
+
+// velocityStage adds the views per hour each video got since it was published
+// as velocity, counting videos younger than velocityMinAgeHours as that old.
+func velocityStage(now time.Time) bson.D {
+	hoursSincePublished := bson.D{{Key: "$divide", Value: bson.A{
+		bson.D{{Key: "$subtract", Value: bson.A{now, "$publishedAt"}}},
+		int64(time.Hour / time.Millisecond),
+	}}}
+	return bson.D{{Key: "$addFields", Value: bson.D{{Key: "velocity", Value: bson.D{{Key: "$divide", Value: bson.A{
+		bson.D{{Key: "$ifNull", Value: bson.A{"$viewCount", 0}}},
+		bson.D{{Key: "$max", Value: bson.A{velocityMinAgeHours, hoursSincePublished}}},
+	}}}}}}}
+}
+
+// velocityPipeline ranks the videos matched by the stages of match by
+// velocity, returning limit of them after skip. scoreMeta, when set, is the
+// $meta of the search relevance kept as score. A projection keeps only its
+// fields, and score.
+func velocityPipeline(match mongo.Pipeline, scoreMeta string, projection bson.D, now time.Time, skip, limit int) mongo.Pipeline {
+	pipeline := append(mongo.Pipeline{}, match...)
+	if scoreMeta != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: scoreMeta}}}}}})
+	}
+	pipeline = append(pipeline,
+		velocityStage(now),
+		bson.D{{Key: "$sort", Value: velocitySort}},
+		bson.D{{Key: "$skip", Value: skip}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+	if projection != nil {
+		if scoreMeta != "" {
+			projection = append(append(bson.D{}, projection...), bson.E{Key: "score", Value: 1})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+	}
+	return pipeline
+}
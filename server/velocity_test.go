@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// evalVelocity evaluates the velocity expression of velocityStage for a
+// document, the way mongo does for the operators it uses.
+func evalVelocity(t *testing.T, expr interface{}, doc bson.M) float64 {
+	t.Helper()
+	switch e := expr.(type) {
+	case string:
+		switch v := doc[e[1:]].(type) {
+		case time.Time:
+			return float64(v.UnixMilli())
+		case int64:
+			return float64(v)
+		case nil:
+			return 0
+		}
+	case time.Time:
+		return float64(e.UnixMilli())
+	case int:
+		return float64(e)
+	case int64:
+		return float64(e)
+	case bson.D:
+		args := e[0].Value.(bson.A)
+		a := evalVelocity(t, args[0], doc)
+		switch e[0].Key {
+		case "$divide":
+			return a / evalVelocity(t, args[1], doc)
+		case "$subtract":
+			return a - evalVelocity(t, args[1], doc)
+		case "$max":
+			if b := evalVelocity(t, args[1], doc); b > a {
+				return b
+			}
+			return a
+		case "$ifNull":
+			if v, ok := args[0].(string); ok && doc[v[1:]] == nil {
+				return evalVelocity(t, args[1], doc)
+			}
+			return a
+		}
+	}
+	t.Fatalf("unexpected expression %v", expr)
+	return 0
+}
+
+func TestVelocityStage(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 0, 0, 0, time.UTC)
+	stage := velocityStage(now)
+	expr := stage[0].Value.(bson.D)[0].Value
+
+	tests := []struct {
+		name string
+		doc  bson.M
+		want float64
+	}{
+		{"day old", bson.M{"viewCount": int64(2400), "publishedAt": now.Add(-24 * time.Hour)}, 100},
+		{"two hours old", bson.M{"viewCount": int64(500), "publishedAt": now.Add(-2 * time.Hour)}, 250},
+		{"brand new uses the floor", bson.M{"viewCount": int64(30), "publishedAt": now.Add(-time.Minute)}, 30},
+		{"no view count", bson.M{"publishedAt": now.Add(-5 * time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evalVelocity(t, expr, tt.doc); got != tt.want {
+				t.Errorf("velocity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVelocityRanking(t *testing.T) {
+	now := time.Now()
+	expr := velocityStage(now)[0].Value.(bson.D)[0].Value
+	// Most views, but over a month: 10 views an hour
+	old := bson.M{"viewCount": int64(7200), "publishedAt": now.Add(-720 * time.Hour)}
+	// Few views in a few hours: 100 views an hour
+	rising := bson.M{"viewCount": int64(300), "publishedAt": now.Add(-3 * time.Hour)}
+	// A minute old, 50 views would be 3000 an hour without the floor
+	fresh := bson.M{"viewCount": int64(50), "publishedAt": now.Add(-time.Minute)}
+
+	if !(evalVelocity(t, expr, rising) > evalVelocity(t, expr, fresh) && evalVelocity(t, expr, fresh) > evalVelocity(t, expr, old)) {
+		t.Errorf("want rising > fresh > old, got %v, %v, %v",
+			evalVelocity(t, expr, rising), evalVelocity(t, expr, fresh), evalVelocity(t, expr, old))
+	}
+}
+
+func TestVelocityPipeline(t *testing.T) {
+	match := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "source", Value: "a"}}}}}
+	projection := bson.D{{Key: "youtubeId", Value: 1}}
+	pipeline := velocityPipeline(match, "textScore", projection, time.Now(), 20, 11)
+
+	var stages []string
+	for _, stage := range pipeline {
+		stages = append(stages, stage[0].Key)
+	}
+	want := []string{"$match", "$addFields", "$addFields", "$sort", "$skip", "$limit", "$project"}
+	if len(stages) != len(want) {
+		t.Fatalf("stages = %v, want %v", stages, want)
+	}
+	for i := range want {
+		if stages[i] != want[i] {
+			t.Fatalf("stages = %v, want %v", stages, want)
+		}
+	}
+	if sort := pipeline[3][0].Value.(bson.D); sort[0].Key != "velocity" || sort[0].Value != -1 {
+		t.Errorf("sort = %v", sort)
+	}
+	if skip, limit := pipeline[4][0].Value, pipeline[5][0].Value; skip != 20 || limit != 11 {
+		t.Errorf("skip, limit = %v, %v", skip, limit)
+	}
+	if project := pipeline[6][0].Value.(bson.D); len(project) != 2 || project[1].Key != "score" {
+		t.Errorf("project = %v, want youtubeId and score", project)
+	}
+	if len(projection) != 1 {
+		t.Error("the projection passed in was modified")
+	}
+
+	if pipeline := velocityPipeline(match, "", nil, time.Now(), 0, 11); len(pipeline) != 5 {
+		t.Errorf("without score or projection got %d stages, want 5", len(pipeline))
+	}
+}
+
+func TestVideosSortVelocity(t *testing.T) {
+	q := url.Values{"sort": {"velocity"}}
+	if got := videosSort(q, false); got != "velocity" {
+		t.Errorf("videosSort = %s, want velocity", got)
+	}
+	if got := videosSort(q, true); got != "newest" {
+		t.Errorf("videosSort in cursor mode = %s, want newest", got)
+	}
+}
@@ -0,0 +1,4 @@
+// Package videospb holds the protobuf types of the videos API.
+package videospb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative videos.proto
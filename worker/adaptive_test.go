@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptInterval(t *testing.T) {
+	base, max := time.Minute, 5*time.Minute
+	tests := []struct {
+		name    string
+		current time.Duration
+		fetched int
+		want    time.Duration
+	}{
+		{"backs off when nothing is new", time.Minute, 0, 2 * time.Minute},
+		{"keeps backing off", 2 * time.Minute, 0, 4 * time.Minute},
+		{"capped at max", 4 * time.Minute, 0, max},
+		{"stays at max", max, 0, max},
+		{"resets once videos show up", max, 3, base},
+		{"stays at base while videos show up", base, 1, base},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := adaptInterval(tt.current, base, max, tt.fetched); got != tt.want {
+				t.Errorf("adaptInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptIntervalSequence(t *testing.T) {
+	base, max := time.Minute, 10*time.Minute
+	interval := base
+	var got []time.Duration
+	for _, fetched := range []int{0, 0, 0, 0, 0, 2, 0} {
+		interval = adaptInterval(interval, base, max, fetched)
+		got = append(got, interval)
+	}
+	want := []time.Duration{2 * time.Minute, 4 * time.Minute, 8 * time.Minute, max, max, base, 2 * time.Minute}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cycle %d: interval %v, want %v", i, got[i], want[i])
+		}
+	}
+}
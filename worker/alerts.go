@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// emptyStreakAlert is what gets posted to ALERT_WEBHOOK_URL.
+type emptyStreakAlert struct {
+	Keyword     string    `json:"keyword"`
+	EmptyCycles int       `json:"emptyCycles"`
+	Since       time.Time `json:"since"`
+	Duration    string    `json:"duration"`
+}
+
+// emptyStreak alerts once a keyword has gone threshold consecutive cycles
+// without new videos, which usually means collection broke silently rather
+// than nobody publishing.
+type emptyStreak struct {
+	keyword    string
+	threshold  int
+	webhookURL string
+
+	cycles  int
+	since   time.Time
+	alerted bool
+}
+
+// observe records how many videos a cycle fetched. It alerts once per streak,
+// and a cycle with videos starts over.
+func (e *emptyStreak) observe(fetched int, now time.Time) {
+	if e.threshold <= 0 {
+		return
+	}
+	if fetched != 0 {
+		if e.alerted {
+			log.Printf("%s is returning videos again after %d empty cycles", e.keyword, e.cycles)
+		}
+		e.cycles, e.alerted = 0, false
+		return
+	}
+	if e.cycles == 0 {
+		e.since = now
+	}
+	e.cycles++
+	if e.cycles < e.threshold || e.alerted {
+		return
+	}
+	e.alerted = true
+
+	alert := emptyStreakAlert{
+		Keyword:     e.keyword,
+		EmptyCycles: e.cycles,
+		Since:       e.since,
+		Duration:    now.Sub(e.since).Round(time.Second).String(),
+	}
+	log.Printf("Alert: no new videos for %s in %d cycles, since %v (%s)", alert.Keyword, alert.EmptyCycles, alert.Since, alert.Duration)
+	if e.webhookURL != "" {
+		go postAlert(e.webhookURL, alert)
+	}
+}
+
+func postAlert(url string, alert emptyStreakAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("Error: Unable to encode alert: %v", err)
+		return
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error: Unable to post alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Error: Alert webhook responded %s", resp.Status)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEmptyStreakAlerts(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		threshold int
+		fetched   []int
+		want      []emptyStreakAlert
+	}{
+		{"disabled", 0, []int{0, 0, 0, 0}, nil},
+		{"below threshold", 3, []int{0, 0}, nil},
+		{"fires at threshold", 3, []int{0, 0, 0}, []emptyStreakAlert{
+			{Keyword: "cats", EmptyCycles: 3, Since: start, Duration: "2m0s"},
+		}},
+		{"fires once per streak", 3, []int{0, 0, 0, 0, 0}, []emptyStreakAlert{
+			{Keyword: "cats", EmptyCycles: 3, Since: start, Duration: "2m0s"},
+		}},
+		{"videos reset the streak", 3, []int{0, 0, 4, 0, 0}, nil},
+		{"fires again after recovering", 2, []int{0, 0, 1, 0, 0}, []emptyStreakAlert{
+			{Keyword: "cats", EmptyCycles: 2, Since: start, Duration: "1m0s"},
+			{Keyword: "cats", EmptyCycles: 2, Since: start.Add(3 * time.Minute), Duration: "1m0s"},
+		}},
+		{"first empty cycle", 1, []int{7, 0}, []emptyStreakAlert{
+			{Keyword: "cats", EmptyCycles: 1, Since: start.Add(time.Minute), Duration: "0s"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posted := make(chan emptyStreakAlert, len(tt.fetched))
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var alert emptyStreakAlert
+				if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+					t.Errorf("undecodable alert: %v", err)
+				}
+				posted <- alert
+			}))
+			defer srv.Close()
+
+			streak := emptyStreak{keyword: "cats", threshold: tt.threshold, webhookURL: srv.URL}
+			for i, n := range tt.fetched {
+				streak.observe(n, start.Add(time.Duration(i)*time.Minute))
+			}
+
+			// Alerts are posted in the background
+			var got []emptyStreakAlert
+			for range tt.want {
+				select {
+				case alert := <-posted:
+					got = append(got, alert)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("posted %v, want %v", got, tt.want)
+				}
+			}
+			select {
+			case alert := <-posted:
+				t.Fatalf("posted %v and %v, want only %v", got, alert, tt.want)
+			case <-time.After(50 * time.Millisecond):
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].Since.Before(got[j].Since) })
+			for i := range got {
+				if !got[i].Since.Equal(tt.want[i].Since) {
+					t.Errorf("alert %d since %v, want %v", i, got[i].Since, tt.want[i].Since)
+				}
+				got[i].Since = tt.want[i].Since
+				if got[i] != tt.want[i] {
+					t.Errorf("alert %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"example.com/hello/internal/model"
+	"example.com/hello/internal/mongoenv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collectionFor returns the collection videos for searchTerm are stored in:
+// the one searchTerm is an alias of, otherwise the one named after it. It
+// exits when searchTerm can't name a collection.
+func (s *Service) collectionFor(ctx context.Context, searchTerm string) string {
+	name, err := model.ValidateCollectionName(searchTerm)
+	if err != nil {
+		log.Fatalf("Error: Unable to store videos for %q: %v", searchTerm, err)
+	}
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var doc struct {
+		Collection string `bson:"collection"`
+	}
+	err = s.database.Collection(model.AliasesCollection).FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(&doc)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Error: Unable to resolve alias %s: %v", name, err)
+		}
+		return name
+	}
+	log.Printf("Storing videos for %s in its alias collection %s", searchTerm, doc.Collection)
+	return doc.Collection
+}
+
+// storageCollection returns the collection the videos of the keyword
+// collectionFor named are written to: that one, or the shared collection with
+// STORAGE_MODE=shared.
+func (s *Service) storageCollection(keyword string) string {
+	if s.sharedStorage {
+		return mongoenv.SharedCollection
+	}
+	return keyword
+}
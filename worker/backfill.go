@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"time"
+)
+
+// defaultBackfillWindowDays is the length of the windows backfill searches
+const defaultBackfillWindowDays = 30
+
+// backfill runs the backfill subcommand:
+//
+//	worker backfill [--since=2006-01-02] [--window-days=30] <searchTerm>
+//
+// Searches only return a few hundred results, so it walks back in time from now
+// one window of publishedAfter/publishedBefore at a time, storing each window's
+// videos like polling does. It stops once it reaches --since, or without it at
+// the first window with no videos, and records the run in runsCollection.
+func (s *Service) backfill(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	sinceFlag := fs.String("since", "", "oldest publish date to go back to, as YYYY-MM-DD. Defaults to the first empty window")
+	windowDays := fs.Int("window-days", defaultBackfillWindowDays, "length in days of each searched window")
+	positional := parseArgs(fs, args)
+	if len(positional) != 1 {
+		log.Fatal("Usage: worker backfill [--since=YYYY-MM-DD] [--window-days=30] <searchTerm>")
+	}
+	if *windowDays < 1 {
+		log.Fatal("--window-days must be at least 1")
+	}
+	var since time.Time
+	if *sinceFlag != "" {
+		var err error
+		if since, err = time.Parse("2006-01-02", *sinceFlag); err != nil {
+			log.Fatalf("--since must be a date as YYYY-MM-DD: %v", err)
+		}
+	}
+	searchTerm := positional[0]
+	collection := s.collectionFor(ctx, searchTerm)
+	window := time.Duration(*windowDays) * 24 * time.Hour
+
+	run := runRecord{Mode: "backfill", Keyword: searchTerm, StartedAt: time.Now()}
+	var err error
+	for end := s.now(ctx); since.IsZero() || end.After(since); end = end.Add(-window) {
+		if ctx.Err() != nil {
+			err = errors.New("backfill interrupted")
+			break
+		}
+		start := end.Add(-window)
+		if !since.IsZero() && start.Before(since) {
+			start = since
+		}
+		var videos []interface{}
+		videos, err = s.fetchWindow(ctx, searchTerm, start, end, s.maxResults)
+		run.Fetched += len(videos)
+		if len(videos) != 0 {
+			inserted, _, saveErr := s.saveVideosToDB(ctx, collection, videos)
+			run.Inserted += inserted
+			if err == nil {
+				err = saveErr
+			}
+		}
+		log.Printf("Backfilled %s from %s to %s: %d videos", searchTerm, start.Format(time.RFC3339), end.Format(time.RFC3339), len(videos))
+		if err != nil || (since.IsZero() && len(videos) == 0) {
+			break
+		}
+	}
+	s.finishRun(ctx, run, err)
+}
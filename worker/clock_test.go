@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestIsSkewed(t *testing.T) {
+	tests := []struct {
+		skew time.Duration
+		want bool
+	}{
+		{0, false},
+		{maxClockSkew, false},
+		{-maxClockSkew, false},
+		{maxClockSkew + time.Millisecond, true},
+		{-maxClockSkew - time.Millisecond, true},
+		{time.Hour, true},
+	}
+	for _, tt := range tests {
+		if got := isSkewed(tt.skew); got != tt.want {
+			t.Errorf("isSkewed(%v) = %v, want %v", tt.skew, got, tt.want)
+		}
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name string
+		// How far mongo's clock is behind the local one
+		behind time.Duration
+	}{
+		{"in sync", 0},
+		{"local clock ahead", time.Hour},
+		{"local clock behind", -90 * time.Second},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "localTime", Value: time.Now().Add(-tt.behind)}))
+			s := &Service{database: mt.DB}
+			skew, err := s.clockSkew(context.Background())
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if diff := skew - tt.behind; diff > time.Second || diff < -time.Second {
+				mt.Errorf("clockSkew() = %v, want about %v", skew, tt.behind)
+			}
+		})
+	}
+}
+
+func TestNowUsesServerTime(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	serverTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mt.Run("server time", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "localTime", Value: serverTime}))
+		s := &Service{database: mt.DB, useServerTime: true}
+		if got := s.now(context.Background()); !got.Equal(serverTime) {
+			mt.Errorf("now() = %v, want mongo's %v", got, serverTime)
+		}
+	})
+	mt.Run("falls back to local time", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "unauthorized"}))
+		s := &Service{database: mt.DB, useServerTime: true}
+		if got := s.now(context.Background()); time.Since(got) > time.Minute {
+			mt.Errorf("now() = %v, want the local time", got)
+		}
+	})
+	mt.Run("local time", func(mt *mtest.T) {
+		s := &Service{database: mt.DB}
+		if got := s.now(context.Background()); time.Since(got) > time.Minute {
+			mt.Errorf("now() = %v, want the local time", got)
+		}
+	})
+}
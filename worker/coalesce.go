@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// saveCoalescer holds back the saves of a keyword for a window and writes
+// everything that came in meanwhile in one go, so bursts of cycles cost one
+// round of inserts.
+type saveCoalescer struct {
+	s          *Service
+	collection string
+	window     time.Duration
+
+	mu     sync.Mutex
+	videos []interface{}
+	// Metrics of the pending cycles, merged into the first one's
+	cycle *cycleMetrics
+	timer *time.Timer
+	// Flushes started by the timer, for close to wait on
+	flushing sync.WaitGroup
+}
+
+// add queues a cycle's videos, starting the window if none is open.
+func (c *saveCoalescer) add(ctx context.Context, videos []interface{}, cycle cycleMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.videos = append(c.videos, videos...)
+	if c.cycle == nil {
+		c.cycle = &cycle
+	} else {
+		c.cycle.Fetched += cycle.Fetched
+		c.cycle.QuotaUsed += cycle.QuotaUsed
+		if cycle.Error != "" {
+			c.cycle.Error = cycle.Error
+		}
+		c.cycle.windowEnd = cycle.windowEnd
+	}
+	if c.timer == nil {
+		c.flushing.Add(1)
+		c.timer = time.AfterFunc(c.window, func() {
+			defer c.flushing.Done()
+			c.flush(ctx)
+		})
+	}
+}
+
+// flush saves whatever is pending.
+func (c *saveCoalescer) flush(ctx context.Context) {
+	c.mu.Lock()
+	videos, cycle := c.videos, c.cycle
+	if c.timer != nil && c.timer.Stop() {
+		c.flushing.Done()
+	}
+	c.videos, c.cycle, c.timer = nil, nil, nil
+	c.mu.Unlock()
+
+	if cycle != nil {
+		c.s.save(ctx, c.collection, videos, *cycle)
+	}
+}
+
+// close saves the pending videos on shutdown, so they aren't lost, and waits
+// for a flush the timer already started.
+func (c *saveCoalescer) close(ctx context.Context) {
+	c.flush(ctx)
+	c.flushing.Wait()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSaveCoalescer(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	videos := func(ids ...string) []interface{} {
+		var out []interface{}
+		for _, id := range ids {
+			out = append(out, model.Video{YoutubeID: id})
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		// Whether the window closes between the saves
+		waitBetween bool
+		// Whether the saves are flushed by the timer rather than on shutdown
+		waitAfter  bool
+		wantWrites []int
+	}{
+		{"rapid saves flushed by the timer", false, true, []int{4}},
+		{"rapid saves flushed on shutdown", false, false, []int{4}},
+		{"saves in separate windows", true, true, []int{2, 2}},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := &Service{database: mt.DB, insertBatchSize: 100}
+			s.existingCollections.Replace([]string{"cats"})
+			for range tt.wantWrites {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+			}
+			c := &saveCoalescer{s: s, collection: "cats", window: 20 * time.Millisecond}
+			ctx := context.Background()
+
+			c.add(ctx, videos("video000001", "video000002"), cycleMetrics{Keyword: "cats", Fetched: 2})
+			if tt.waitBetween {
+				c.flushing.Wait()
+			}
+			c.add(ctx, videos("video000003", "video000004"), cycleMetrics{Keyword: "cats", Fetched: 2})
+			if tt.waitAfter {
+				c.flushing.Wait()
+			}
+			c.close(ctx)
+
+			var writes []int
+			for _, e := range mt.GetAllStartedEvents() {
+				if e.CommandName != "update" {
+					mt.Errorf("ran %s, want only bulk writes", e.CommandName)
+					continue
+				}
+				updates, _ := e.Command.Lookup("updates").Array().Values()
+				writes = append(writes, len(updates))
+			}
+			if fmt.Sprint(writes) != fmt.Sprint(tt.wantWrites) {
+				mt.Errorf("bulk writes of %v videos, want %v", writes, tt.wantWrites)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dedupe runs the dedupe subcommand:
+//
+//	worker dedupe [--keep=earliest|latest] [searchTerm...]
+//
+// It removes documents sharing a youtubeId from the given keyword collections,
+// or all of them, so the unique youtubeId index can be created on collections
+// imported without it.
+func (s *Service) dedupe(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	keep := fs.String("keep", "earliest", "which of the duplicates to keep by insertion order, earliest or latest")
+	keywords := parseArgs(fs, args)
+	if *keep != "earliest" && *keep != "latest" {
+		log.Fatal("--keep must be earliest or latest")
+	}
+	total := 0
+	for _, collection := range s.videoCollections(ctx, keywords) {
+		removed, err := removeDuplicates(ctx, s.database.Collection(collection), *keep == "latest")
+		if err != nil {
+			log.Fatalf("Error: Failed to dedupe %s: %v", collection, err)
+		}
+		log.Printf("Removed %d duplicates from %s", removed, collection)
+		total += removed
+	}
+	log.Printf("Removed %d duplicates in total", total)
+}
+
+// removeDuplicates deletes all but one document per youtubeId in collection,
+// keeping the first inserted one, or the last one when keepLatest is set.
+func removeDuplicates(ctx context.Context, collection *mongo.Collection, keepLatest bool) (int, error) {
+	// _ids grow with insertion time, so they give the insertion order
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$youtubeId"},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "ids.1", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var duplicates []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return 0, err
+		}
+		if keepLatest {
+			duplicates = append(duplicates, group.IDs[:len(group.IDs)-1]...)
+		} else {
+			duplicates = append(duplicates, group.IDs[1:]...)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+	if len(duplicates) == 0 {
+		return 0, nil
+	}
+
+	res, err := collection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: duplicates}}}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRemoveDuplicates(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	// Three copies of one video and two of another, in insertion order
+	a1, a2, a3 := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	b1, b2 := primitive.NewObjectID(), primitive.NewObjectID()
+	groups := []bson.D{
+		{{Key: "_id", Value: "videoAAAAAA"}, {Key: "ids", Value: bson.A{a1, a2, a3}}},
+		{{Key: "_id", Value: "videoBBBBBB"}, {Key: "ids", Value: bson.A{b1, b2}}},
+	}
+	tests := []struct {
+		name        string
+		keepLatest  bool
+		groups      []bson.D
+		wantDeleted []primitive.ObjectID
+	}{
+		{"keep earliest", false, groups, []primitive.ObjectID{a2, a3, b2}},
+		{"keep latest", true, groups, []primitive.ObjectID{a1, a2, b1}},
+		{"no duplicates", false, nil, nil},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "test.cats", mtest.FirstBatch, tt.groups...),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: len(tt.wantDeleted)}),
+			)
+			removed, err := removeDuplicates(context.Background(), mt.DB.Collection("cats"), tt.keepLatest)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if removed != len(tt.wantDeleted) {
+				mt.Errorf("removed %d, want %d", removed, len(tt.wantDeleted))
+			}
+
+			var deleted []primitive.ObjectID
+			for _, e := range mt.GetAllStartedEvents() {
+				if e.CommandName != "delete" {
+					continue
+				}
+				ids, _ := e.Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q", "_id", "$in").Array().Values()
+				for _, id := range ids {
+					deleted = append(deleted, id.ObjectID())
+				}
+			}
+			if len(deleted) != len(tt.wantDeleted) {
+				mt.Fatalf("deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+			for i := range deleted {
+				if deleted[i] != tt.wantDeleted[i] {
+					mt.Errorf("deleted %v, want %v", deleted, tt.wantDeleted)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"example.com/hello/internal/model"
+)
+
+func TestWithinDocumentLimit(t *testing.T) {
+	oversized := model.Video{YoutubeID: "oversized00", Description: strings.Repeat("x", maxDocumentSize)}
+	tests := []struct {
+		name   string
+		videos []interface{}
+		want   []string
+	}{
+		{"all fit", []interface{}{model.Video{YoutubeID: "a"}, model.Video{YoutubeID: "b"}}, []string{"a", "b"}},
+		{"oversized dropped", []interface{}{model.Video{YoutubeID: "a"}, oversized, model.Video{YoutubeID: "b"}}, []string{"a", "b"}},
+		{"only oversized", []interface{}{oversized}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range withinDocumentLimit(tt.videos) {
+				got = append(got, v.(model.Video).YoutubeID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("withinDocumentLimit() kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// fakeYoutube returns a Service whose only API key calls a fake youtube,
+// answering searches with search and video lookups with no statistics.
+func fakeYoutube(t *testing.T, search func(q url.Values) *youtube.SearchListResponse) *Service {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/youtube/v3/search":
+			json.NewEncoder(w).Encode(search(r.URL.Query()))
+		case "/youtube/v3/videos":
+			// Every id requested is found, with a single view
+			response := &youtube.VideoListResponse{}
+			for _, id := range r.URL.Query()["id"] {
+				response.Items = append(response.Items, &youtube.Video{Id: id, Statistics: &youtube.VideoStatistics{ViewCount: 1}})
+			}
+			json.NewEncoder(w).Encode(response)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := youtube.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Service{
+		apiKeys:     []*apiKey{{key: "test", client: client}},
+		maxResults:  searchPageSize,
+		maxPages:    defaultMaxPages,
+		retryPolicy: retryPolicy{attempts: 1},
+	}
+}
+
+func searchResult(id, publishedAt string) *youtube.SearchResult {
+	return &youtube.SearchResult{
+		Id:      &youtube.ResourceId{VideoId: id},
+		Snippet: &youtube.SearchResultSnippet{Title: id, PublishedAt: publishedAt},
+	}
+}
+
+func TestFetchWindowRoundsPublishedAt(t *testing.T) {
+	tests := []struct {
+		round bool
+		want  time.Time
+	}{
+		{false, time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)},
+		{true, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+			return &youtube.SearchListResponse{Items: []*youtube.SearchResult{searchResult("dQw4w9WgXcQ", "2024-05-01T10:00:00.123456789Z")}}
+		})
+		s.roundPublishedAt = tt.round
+		videos, err := s.fetchWindow(context.Background(), "cats", time.Time{}, time.Time{}, s.maxResults)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(videos) != 1 {
+			t.Fatalf("got %d videos, want 1", len(videos))
+		}
+		if got := videos[0].(model.Video).PublishedAt; !got.Equal(tt.want) {
+			t.Errorf("round %v: publishedAt = %v, want %v", tt.round, got, tt.want)
+		}
+	}
+}
+
+func TestPrintVideos(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []*youtube.SearchResult
+		want    []string
+		wantErr bool
+	}{
+		{"videos", []*youtube.SearchResult{searchResult("dQw4w9WgXcQ", "2024-05-01T10:00:00Z"), searchResult("9bZkp7q19f0", "2024-05-01T09:00:00Z")}, []string{"dQw4w9WgXcQ", "9bZkp7q19f0"}, false},
+		{"none", nil, []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+				if q.Get("q") != "cats" {
+					t.Errorf("searched for %q", q.Get("q"))
+				}
+				return &youtube.SearchListResponse{Items: tt.items}
+			})
+			var stdout bytes.Buffer
+			if err := s.printVideos(context.Background(), &stdout, "cats"); (err != nil) != tt.wantErr {
+				t.Fatalf("printVideos() error = %v", err)
+			}
+			var printed []model.Video
+			if err := json.Unmarshal(stdout.Bytes(), &printed); err != nil {
+				t.Fatalf("stdout isn't a JSON array of videos: %v: %s", err, stdout.String())
+			}
+			got := []string{}
+			for _, v := range printed {
+				got = append(got, v.YoutubeID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("printed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var stdout bytes.Buffer
+	if err := (&Service{}).printVideos(context.Background(), &stdout, "cats"); err == nil {
+		t.Error("want an error without an API key")
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "[]" {
+		t.Errorf("printed %q on failure, want []", got)
+	}
+}
+
+func TestFetchWindowCompleteWindows(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	// page returns n results a minute apart, newest first, from the start'th
+	// minute before the window's end
+	page := func(prefix string, start, n int, next string) *youtube.SearchListResponse {
+		end := since.Add(24 * time.Hour)
+		resp := &youtube.SearchListResponse{NextPageToken: next}
+		for i := 0; i < n; i++ {
+			id := prefix + strconv.Itoa(1000+i) + "abcdef"
+			resp.Items = append(resp.Items, searchResult(id[:11], end.Add(-time.Duration(start+i)*time.Minute).Format(time.RFC3339)))
+		}
+		return resp
+	}
+	tests := []struct {
+		name            string
+		completeWindows bool
+		maxPages        int
+		pages           map[string]*youtube.SearchListResponse
+		wantVideos      int
+		wantCalls       int
+	}{
+		{
+			"window larger than one page",
+			true, 1,
+			map[string]*youtube.SearchListResponse{"": page("a", 0, 50, "p2"), "p2": page("b", 50, 50, "p3"), "p3": page("c", 100, 20, "p4")},
+			120, 3,
+		},
+		{
+			"stops at the page limit otherwise",
+			false, 1,
+			map[string]*youtube.SearchListResponse{"": page("a", 0, 50, "p2"), "p2": page("b", 50, 50, "p3")},
+			50, 1,
+		},
+		{
+			"stops once the window's start is reached",
+			true, 1,
+			// The second page reaches back before since
+			map[string]*youtube.SearchListResponse{"": page("a", 0, 50, "p2"), "p2": page("b", 24*60-10, 50, "p3"), "p3": page("c", 24*60+40, 50, "")},
+			100, 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+				calls++
+				if tt.completeWindows && q.Get("order") != "date" {
+					t.Errorf("order = %q, want date", q.Get("order"))
+				}
+				return tt.pages[q.Get("pageToken")]
+			})
+			s.completeWindows = tt.completeWindows
+			s.maxPages = tt.maxPages
+			videos, err := s.fetchWindow(context.Background(), "cats", since, time.Time{}, s.maxResults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(videos) != tt.wantVideos || calls != tt.wantCalls {
+				t.Errorf("got %d videos in %d calls, want %d in %d", len(videos), calls, tt.wantVideos, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFetchWindowTagsSource(t *testing.T) {
+	tests := []struct {
+		instance string
+		want     string
+	}{
+		{"", ""},
+		{"worker-eu", "worker-eu"},
+		{"worker-us", "worker-us"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.instance, func(t *testing.T) {
+			t.Setenv("INSTANCE_NAME", tt.instance)
+			s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+				return &youtube.SearchListResponse{Items: []*youtube.SearchResult{searchResult("dQw4w9WgXcQ", "2024-05-01T10:00:00Z")}}
+			})
+			s.loadOptions()
+			videos, err := s.fetchVideos(context.Background(), "cats", time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			video := videos[0].(model.Video)
+			if video.Source != tt.want {
+				t.Errorf("source = %q, want %q", video.Source, tt.want)
+			}
+
+			// Kept from the instance that first stored the video
+			upsert, err := videoUpsert(video, "cats", true, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			onInsert := upsert.(*mongo.UpdateOneModel).Update.(bson.M)["$setOnInsert"].(bson.M)
+			if source, _ := onInsert["source"].(string); source != tt.want {
+				t.Errorf("upsert sets source %q on insert, want %q", source, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchWindowDropsInvalidIDs(t *testing.T) {
+	s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+		return &youtube.SearchListResponse{Items: []*youtube.SearchResult{
+			searchResult("dQw4w9WgXcQ", "2024-05-01T10:00:00Z"),
+			searchResult("", "2024-05-01T10:00:00Z"),
+			searchResult("short", "2024-05-01T10:00:00Z"),
+			searchResult("has spaces!", "2024-05-01T10:00:00Z"),
+			searchResult("dQw4w9WgXcQ<script>", "2024-05-01T10:00:00Z"),
+			// A channel result has no video id
+			{Id: &youtube.ResourceId{Kind: "youtube#channel", ChannelId: "UCchannel"}, Snippet: &youtube.SearchResultSnippet{}},
+			{Snippet: &youtube.SearchResultSnippet{}},
+			searchResult("9bZkp7q19f0", "2024-05-01T09:00:00Z"),
+			// Repeated on an overlapping page
+			searchResult("dQw4w9WgXcQ", "2024-05-01T10:00:00Z"),
+		}}
+	})
+	videos, err := s.fetchVideos(context.Background(), "cats", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range videos {
+		got = append(got, v.(model.Video).YoutubeID)
+	}
+	if want := []string{"dQw4w9WgXcQ", "9bZkp7q19f0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+}
+
+func TestFetchWindowEventType(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", ""},
+		{"none", ""},
+		{"live", "live"},
+		{"upcoming", "upcoming"},
+		{"completed", "completed"},
+		{"streaming", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("EVENT_TYPE", tt.env)
+			var query url.Values
+			s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+				query = q
+				item := searchResult("dQw4w9WgXcQ", "2024-05-01T10:00:00Z")
+				item.Snippet.LiveBroadcastContent = "live"
+				return &youtube.SearchListResponse{Items: []*youtube.SearchResult{item}}
+			})
+			s.loadOptions()
+			videos, err := s.fetchVideos(context.Background(), "cats", time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := query.Get("eventType"); got != tt.want {
+				t.Errorf("searched with eventType %q, want %q", got, tt.want)
+			}
+			if _, ok := query["eventType"]; ok && query.Get("type") != "video" {
+				t.Errorf("eventType sent with type %q, youtube requires video", query.Get("type"))
+			}
+			if got := videos[0].(model.Video).LiveBroadcastContent; got != "live" {
+				t.Errorf("liveBroadcastContent = %q, want live", got)
+			}
+		})
+	}
+}
+
+func TestFetchVideosRecordsFetchTiming(t *testing.T) {
+	for _, env := range []string{"", "true"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv("RECORD_FETCH_TIMING", env)
+			s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+				return &youtube.SearchListResponse{Items: []*youtube.SearchResult{
+					searchResult("dQw4w9WgXcQ", "2024-05-01T10:00:00Z"),
+					searchResult("9bZkp7q19f0", "2024-05-01T09:00:00Z"),
+				}}
+			})
+			s.loadOptions()
+			before := time.Now()
+			videos, err := s.fetchVideos(context.Background(), "cats", time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range videos {
+				video := v.(model.Video)
+				if env != "true" {
+					if video.FetchTiming != nil {
+						t.Errorf("%s: fetchTiming = %+v, want none", video.YoutubeID, video.FetchTiming)
+					}
+					continue
+				}
+				timing := video.FetchTiming
+				if timing == nil {
+					t.Fatalf("%s: no fetchTiming", video.YoutubeID)
+				}
+				if timing.SeenAt.Before(before) || timing.SeenAt.After(time.Now()) {
+					t.Errorf("%s: seenAt = %v, want during the fetch", video.YoutubeID, timing.SeenAt)
+				}
+				if !timing.Enriched || !video.Enriched {
+					t.Errorf("%s: fetchTiming = %+v, want enriched", video.YoutubeID, timing)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSaveVideosToDBUnmanagedIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	index := func(unique bool, keys ...bson.E) bson.D {
+		doc := bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D(keys)}, {Key: "name", Value: "index"}}
+		if unique {
+			doc = append(doc, bson.E{Key: "unique", Value: true})
+		}
+		return doc
+	}
+	idIndex := index(false, bson.E{Key: "_id", Value: 1})
+	publishedAt := index(false, bson.E{Key: "publishedAt", Value: -1})
+	text := index(false, bson.E{Key: "_fts", Value: "text"}, bson.E{Key: "_ftsx", Value: 1})
+	youtubeID := index(true, bson.E{Key: "youtubeId", Value: 1})
+	tests := []struct {
+		name         string
+		unmanaged    bool
+		indexes      []bson.D
+		wantCommands []string
+		wantWarning  string
+	}{
+		{
+			name:         "managed indexes are created",
+			wantCommands: []string{"listCollections", "createIndexes", "update"},
+		},
+		{
+			name:         "unmanaged indexes all present",
+			unmanaged:    true,
+			indexes:      []bson.D{idIndex, publishedAt, text, youtubeID},
+			wantCommands: []string{"listCollections", "listIndexes", "update"},
+		},
+		{
+			name:         "unmanaged indexes missing",
+			unmanaged:    true,
+			indexes:      []bson.D{idIndex, publishedAt},
+			wantCommands: []string{"listCollections", "listIndexes", "update"},
+			wantWarning:  "missing indexes on text, youtubeId",
+		},
+		{
+			name:         "unmanaged youtubeId index isn't unique",
+			unmanaged:    true,
+			indexes:      []bson.D{idIndex, publishedAt, text, index(false, bson.E{Key: "youtubeId", Value: 1})},
+			wantCommands: []string{"listCollections", "listIndexes", "update"},
+			wantWarning:  "missing indexes on youtubeId",
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			s := &Service{database: mt.DB, insertBatchSize: 10, unmanagedIndexes: tt.unmanaged}
+			responses := []bson.D{mtest.CreateCursorResponse(0, "test.$cmd.listCollections", mtest.FirstBatch)}
+			if tt.unmanaged {
+				responses = append(responses, mtest.CreateCursorResponse(0, "test.cats.$cmd.listIndexes", mtest.FirstBatch, tt.indexes...))
+			} else {
+				responses = append(responses, mtest.CreateSuccessResponse())
+			}
+			responses = append(responses, mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: "x"}}}}))
+			mt.AddMockResponses(responses...)
+
+			inserted, _, err := s.saveVideosToDB(context.Background(), "cats", []interface{}{model.Video{YoutubeID: "dQw4w9WgXcQ"}})
+			if err != nil || inserted != 1 {
+				mt.Fatalf("saveVideosToDB() = %d, %v; want the video stored", inserted, err)
+			}
+			var commands []string
+			for _, e := range mt.GetAllStartedEvents() {
+				commands = append(commands, e.CommandName)
+			}
+			if !reflect.DeepEqual(commands, tt.wantCommands) {
+				mt.Errorf("ran %v, want %v", commands, tt.wantCommands)
+			}
+			warned := strings.Contains(logs.String(), "Warning:")
+			if warned != (tt.wantWarning != "") || !strings.Contains(logs.String(), tt.wantWarning) {
+				mt.Errorf("logged %q, want warning %q", logs.String(), tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+// apiKey is a youtube API key with the client using it.
+type apiKey struct {
+	key    string
+	client *youtube.Service
+	// Set once the key ran out of quota, until every key has
+	burned bool
+}
+
+// label identifies the key in logs without leaking it.
+func (k *apiKey) label() string {
+	if len(k.key) <= 4 {
+		return "..."
+	}
+	return "..." + k.key[len(k.key)-4:]
+}
+
+func newAPIKeys(keys []string) ([]*apiKey, error) {
+	var apiKeys []*apiKey
+	for _, key := range keys {
+		client, err := newYoutubeClient(key)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, &apiKey{key: key, client: client})
+	}
+	return apiKeys, nil
+}
+
+// apiKeysFromEnv reads the comma separated API_KEYS, or API_KEY.
+func apiKeysFromEnv() []string {
+	value := os.Getenv("API_KEYS")
+	if value == "" {
+		value = os.Getenv("API_KEY")
+	}
+	var keys []string
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		log.Fatal("Missing API_KEY")
+	}
+	return keys
+}
+
+// isQuotaExceeded reports whether err is youtube refusing a call because the
+// key's quota is used up.
+func isQuotaExceeded(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 403 {
+		return false
+	}
+	for _, e := range apiErr.Errors {
+		if e.Reason == "quotaExceeded" || e.Reason == "dailyLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// search runs the search call built by newCall with withAPIKey.
+func (s *Service) search(ctx context.Context, newCall func(*youtube.Service) *youtube.SearchListCall) (*youtube.SearchListResponse, error) {
+	var response *youtube.SearchListResponse
+	err := s.withAPIKey(ctx, searchQuotaCost, func(client *youtube.Service) (err error) {
+		response, err = newCall(client).Context(ctx).Do()
+		return err
+	})
+	return response, err
+}
+
+// withAPIKey runs do with the client of the current API key, moving on to the
+// next key whenever the current one is out of quota. Once every key is burned
+// it logs them and gives up, and the next call starts over from the first key,
+// as quotas reset daily. Transient failures are retried with s.retry first.
+// Calls that would go over DAILY_QUOTA fail with errDailyQuotaReached.
+// cost is the quota units each attempt counts for.
+func (s *Service) withAPIKey(ctx context.Context, cost int, do func(*youtube.Service) error) error {
+	for {
+		key := s.apiKeys[s.currentKey]
+		err := s.retry(ctx, func() error {
+			if err := s.quota.spend(cost, time.Now()); err != nil {
+				return err
+			}
+			s.quotaUsed += cost
+			return do(key.client)
+		})
+		if !isQuotaExceeded(err) {
+			return err
+		}
+
+		key.burned = true
+		next := -1
+		for i := 1; i < len(s.apiKeys); i++ {
+			j := (s.currentKey + i) % len(s.apiKeys)
+			if !s.apiKeys[j].burned {
+				next = j
+				break
+			}
+		}
+		if next == -1 {
+			var labels []string
+			for _, k := range s.apiKeys {
+				labels = append(labels, k.label())
+				k.burned = false
+			}
+			log.Printf("Error: All API keys are out of quota: %s", strings.Join(labels, ", "))
+			return fmt.Errorf("all %d API keys are out of quota: %w", len(s.apiKeys), err)
+		}
+		log.Printf("API key %s is out of quota, switching to %s", key.label(), s.apiKeys[next].label())
+		s.currentKey = next
+	}
+}
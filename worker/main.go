@@ -2,211 +2,1197 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"google.golang.org/api/googleapi/transport"
 	"google.golang.org/api/youtube/v3"
 
+	"example.com/hello/internal/logging"
+	"example.com/hello/internal/model"
+	"example.com/hello/internal/mongoenv"
+
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type Video struct {
-	ID           primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	YoutubeID    string             `json:"youtubeId,omitempty" bson:"youtubeId,omitempty"`
-	Title        string             `json:"title,omitempty" bson:"title,omitempty"`
-	Description  string             `json:"description,omitempty" bson:"description,omitempty"`
-	PublishedAt  time.Time          `json:"publishedAt,omitempty" bson:"publishedAt,omitempty"`
-	ThumbnailUrl string             `json:"thumbnailUrl,omitempty" bson:"thumbnailUrl,omitempty"`
-}
-
-func handleError(err error) {
-	fmt.Printf("Error: %+v", err)
-}
+const (
+	// maxDocumentSize is mongo's BSON document size limit
+	maxDocumentSize = 16 * 1024 * 1024
+	// searchPageSize is the max results youtube returns per search page
+	searchPageSize = 50
+	// maxClockSkew is how far the local clock can be from mongo's before it's reported
+	maxClockSkew = 5 * time.Second
+	// searchQuotaCost is the quota units a search call costs
+	searchQuotaCost = 100
+	// defaultInsertBatchSize is how many videos are inserted per InsertMany
+	defaultInsertBatchSize = 100
+	// defaultMaxPages is how many search pages a fetch follows, unless COMPLETE_WINDOWS follows them all
+	defaultMaxPages = 5
+	// defaultDBTimeout bounds each database operation unless DB_TIMEOUT is set
+	defaultDBTimeout = 10 * time.Second
+)
 
 type Service struct {
-	youtubeClient       *youtube.Service
+	apiKeys             []*apiKey
+	currentKey          int
 	mongoClient         *mongo.Client
 	database            *mongo.Database
-	existingCollections []string
+	existingCollections model.CollectionSet
+	traceWindows        bool
+	roundPublishedAt    bool
+	completeWindows     bool
+	compress            bool
+	useServerTime       bool
+	recordMetrics       bool
+	recordFetchTiming   bool
+	maxResults          int64
+	maxPages            int
+	textLanguage        string
+	instanceName        string
+	insertBatchSize     int
+	eventType           string
+	videoDuration       string
+	regionCode          string
+	relevanceLanguage   string
+	videoCaption        string
+	unmanagedIndexes    bool
+	sharedStorage       bool
+	updateMutableFields bool
+	dbTimeout           time.Duration
+	retryPolicy         retryPolicy
+	quota               quotaTracker
+	saves               saveTally
+	languageOverride    string
+
+	// quota units used by calls so far
+	quotaUsed int
+	// Held by the search term polling during its fetch
+	fetching sync.Mutex
 }
 
-func New(ctx context.Context, apiKey, mongoUri, mongoDbName string) *Service {
+func newYoutubeClient(apiKey string) (*youtube.Service, error) {
 	httpClient := &http.Client{
 		Transport: &transport.APIKey{Key: apiKey},
 	}
+	return youtube.New(httpClient)
+}
 
-	youtubeClient, err := youtube.New(httpClient)
+// connectDatabase connects to mongo and pings it to make sure it's reachable.
+func connectDatabase(ctx context.Context, mongoUri string) (*mongo.Client, error) {
+	mongoOptions := mongoenv.ClientOptions(mongoUri)
+	mongoClient, err := mongo.Connect(ctx, mongoOptions)
 	if err != nil {
-		log.Fatalf("Error creating new YouTube client: %v", err)
+		return nil, fmt.Errorf("mongo connection failed: %w", err)
 	}
 
-	mongoOptions := options.Client().ApplyURI(mongoUri)
-	mongoClient, err := mongo.Connect(ctx, mongoOptions)
+	err = mongoClient.Ping(ctx, nil)
 	if err != nil {
-		log.Fatalf("Error: Mongo connection failed: %v", err)
+		mongoClient.Disconnect(ctx)
+		return nil, fmt.Errorf("database ping failed: %w", err)
 	}
+	return mongoClient, nil
+}
 
-	err = mongoClient.Ping(ctx, nil)
+// New connects to youtube and mongo, retrying as set by STARTUP_ATTEMPTS and
+// STARTUP_RETRY_DELAY. It exits once they're used up.
+func New(ctx context.Context, keys []string, mongoUri, mongoDbName string) *Service {
+	policy := startupPolicyFromEnv()
+	var apiKeys []*apiKey
+	err := retryStartup(ctx, "creating the YouTube clients", policy, func() (err error) {
+		apiKeys, err = newAPIKeys(keys)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Error creating new YouTube client: %v", err)
+	}
+
+	var mongoClient *mongo.Client
+	err = retryStartup(ctx, "connecting to mongo", policy, func() (err error) {
+		mongoClient, err = connectDatabase(ctx, mongoUri)
+		return err
+	})
 	if err != nil {
-		log.Fatalf("Error: Database ping failed: %v", err)
+		log.Fatalf("Error: %v", err)
 	}
 	log.Println("MongoDB connection successful!")
 
 	database := mongoClient.Database(mongoDbName)
 
 	return &Service{
-		youtubeClient: youtubeClient,
-		mongoClient:   mongoClient,
-		database:      database,
+		apiKeys:     apiKeys,
+		mongoClient: mongoClient,
+		database:    database,
 	}
 }
 
-func (s *Service) fetchVideos(searchKey string, since time.Time) []interface{} {
-	if s.youtubeClient == nil {
+// fetchVideos searches youtube for videos about searchKey published after since,
+// following nextPageToken for up to MAX_PAGES pages. On a failed follow up page
+// the videos from the earlier pages are returned along with the error.
+func (s *Service) fetchVideos(ctx context.Context, searchKey string, since time.Time) ([]interface{}, error) {
+	return s.fetchWindow(ctx, searchKey, since, time.Time{}, s.maxResults)
+}
+
+// fetchWindow is fetchVideos for the videos published between since and
+// before, maxResults per search call. A zero before leaves the window open
+// ended.
+func (s *Service) fetchWindow(ctx context.Context, searchKey string, since, before time.Time, maxResults int64) ([]interface{}, error) {
+	if len(s.apiKeys) == 0 {
 		log.Println("Error: youtubeClient not initialised")
-		return nil
+		return nil, errors.New("youtubeClient not initialised")
 	}
 
-	call := s.youtubeClient.Search.List([]string{"id", "snippet"}).
-		Q(searchKey).
-		Type("video").
-		PublishedAfter(since.Format(time.RFC3339)).
-		MaxResults(50)
-	response, err := call.Do()
+	windowEnd := time.Now()
+	if !before.IsZero() {
+		windowEnd = before
+	}
+	newCall := func(client *youtube.Service) *youtube.SearchListCall {
+		call := client.Search.List([]string{"id", "snippet"}).
+			Q(searchKey).
+			Type("video").
+			PublishedAfter(since.Format(time.RFC3339)).
+			MaxResults(maxResults)
+		if !before.IsZero() {
+			call = call.PublishedBefore(before.Format(time.RFC3339))
+		}
+		if s.completeWindows {
+			call = call.Order("date")
+		}
+		if s.eventType != "" {
+			call = call.EventType(s.eventType)
+		}
+		if s.videoDuration != "" {
+			call = call.VideoDuration(s.videoDuration)
+		}
+		if s.regionCode != "" {
+			call = call.RegionCode(s.regionCode)
+		}
+		if s.relevanceLanguage != "" {
+			call = call.RelevanceLanguage(s.relevanceLanguage)
+		}
+		if s.videoCaption != "" {
+			call = call.VideoCaption(s.videoCaption)
+		}
+		return call
+	}
+	response, err := s.search(ctx, newCall)
 	if err != nil {
-		log.Printf("Error: Unable to get search results: %v", err)
+		err = fmt.Errorf("unable to search for %q: %w", searchKey, err)
+		log.Printf("Error: %v", err)
+		return nil, err
 	}
 
 	var videos []interface{}
-	for _, item := range response.Items {
-		v := Video{
-			YoutubeID:    item.Id.VideoId,
-			Title:        item.Snippet.Title,
-			Description:  item.Snippet.Description,
-			ThumbnailUrl: item.Snippet.Thumbnails.Default.Url,
-		}
-		publishedAt, err := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
+	invalidIDs, repeats := 0, 0
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		var oldest time.Time
+		seenAt := time.Now()
+		for _, item := range response.Items {
+			// Ids that can't make a watch url, e.g. from non video results
+			if item.Id == nil || !model.IsYoutubeID(item.Id.VideoId) {
+				invalidIDs++
+				continue
+			}
+			// Pages can overlap when videos get published while paging
+			if seen[item.Id.VideoId] {
+				repeats++
+				continue
+			}
+			seen[item.Id.VideoId] = true
+			v := model.Video{
+				YoutubeID:   item.Id.VideoId,
+				Title:       item.Snippet.Title,
+				Description: item.Snippet.Description,
+				ChannelID:   item.Snippet.ChannelId,
+				Source:      s.instanceName,
+				RegionCode:  s.regionCode,
+
+				LiveBroadcastContent: item.Snippet.LiveBroadcastContent,
+			}
+			if t := item.Snippet.Thumbnails; t != nil {
+				v.Thumbnails = &model.Thumbnails{
+					Default:  thumbnail(t.Default),
+					Medium:   thumbnail(t.Medium),
+					High:     thumbnail(t.High),
+					Standard: thumbnail(t.Standard),
+					Maxres:   thumbnail(t.Maxres),
+				}
+				if t.Default != nil {
+					v.ThumbnailUrl = t.Default.Url
+				}
+			}
+			publishedAt, err := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
+			if err != nil {
+				log.Println("Error: Unable to parse PublishedAt field")
+			} else {
+				if s.roundPublishedAt {
+					// YouTube only has second precision, so this never loses information
+					publishedAt = publishedAt.Truncate(time.Second)
+				}
+				v.PublishedAt = publishedAt
+				if oldest.IsZero() || publishedAt.Before(oldest) {
+					oldest = publishedAt
+				}
+			}
+			if s.traceWindows {
+				v.FetchWindowStart = &since
+				v.FetchWindowEnd = &windowEnd
+			}
+			if s.recordFetchTiming {
+				v.FetchTiming = &model.FetchTiming{SeenAt: seenAt}
+			}
+			videos = append(videos, v)
+		}
+
+		if response.NextPageToken == "" {
+			break
+		}
+		if s.completeWindows {
+			// Results are newest first, so a full page whose oldest video is still
+			// inside the window may have cut off older ones. Keep paging for those.
+			if int64(len(response.Items)) < maxResults || !oldest.After(since) {
+				break
+			}
+		} else if page >= s.maxPages {
+			log.Printf("Warning: Stopped after %d pages of results for %s, raise MAX_PAGES to get the rest", page, searchKey)
+			break
+		}
+		pageToken := response.NextPageToken
+		response, err = s.search(ctx, func(client *youtube.Service) *youtube.SearchListCall {
+			return newCall(client).PageToken(pageToken)
+		})
 		if err != nil {
-			log.Println("Error: Unable to parse PublishedAt field")
-		} else {
-			v.PublishedAt = publishedAt
+			err = fmt.Errorf("unable to get page %d of results for %q: %w", page+1, searchKey, err)
+			log.Printf("Error: %v", err)
+			return videos, err
 		}
-		videos = append(videos, v)
 	}
-	return videos
+	if invalidIDs != 0 {
+		logging.Warn("skipped results with an empty or invalid video id", "search_key", searchKey, "count", invalidIDs)
+	}
+	if repeats != 0 {
+		logging.Info("skipped results repeated within the fetch", "search_key", searchKey, "count", repeats)
+	}
+	s.addStatistics(ctx, videos)
+	return videos, nil
 }
 
-func keywordExistsIn(keyword string, list []string) bool {
-	// TODO: optimise this search
-	for _, c := range list {
-		if c == keyword {
-			return true
-		}
+func thumbnail(t *youtube.Thumbnail) *model.Thumbnail {
+	if t == nil || t.Url == "" {
+		return nil
+	}
+	return &model.Thumbnail{Url: t.Url, Width: t.Width, Height: t.Height}
+}
+
+// serverTime returns mongo's current time.
+func (s *Service) serverTime(ctx context.Context) (time.Time, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var res struct {
+		LocalTime time.Time `bson:"localTime"`
+	}
+	err := s.database.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&res)
+	return res.LocalTime, err
+}
+
+// clockSkew returns how far ahead the local clock is of mongo's.
+func (s *Service) clockSkew(ctx context.Context) (time.Duration, error) {
+	sent := time.Now()
+	serverTime, err := s.serverTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Assume the server read its clock half way through the round trip
+	local := sent.Add(time.Since(sent) / 2)
+	return local.Sub(serverTime), nil
+}
+
+// isSkewed reports whether skew is over maxClockSkew either way.
+func isSkewed(skew time.Duration) bool {
+	return skew > maxClockSkew || skew < -maxClockSkew
+}
+
+// checkClockSkew warns when the local clock is far enough from mongo's to
+// make poll windows miss or duplicate videos.
+func (s *Service) checkClockSkew(ctx context.Context) {
+	skew, err := s.clockSkew(ctx)
+	if err != nil {
+		log.Printf("Error: Unable to get server time: %v", err)
+		return
+	}
+	if isSkewed(skew) {
+		log.Printf("Warning: Local clock is %v off from the database's. Set USE_SERVER_TIME=true to use the database's clock for poll windows", skew)
+	}
+}
+
+// dbContext bounds a database operation by DB_TIMEOUT, so a stalled database
+// fails the operation instead of freezing the poll loop.
+func (s *Service) dbContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := s.dbTimeout
+	if timeout == 0 {
+		timeout = defaultDBTimeout
 	}
-	return false
+	return context.WithTimeout(ctx, timeout)
+}
+
+// now returns the time poll windows are based on: mongo's clock when
+// useServerTime is set, otherwise the local one.
+func (s *Service) now(ctx context.Context) time.Time {
+	if !s.useServerTime {
+		return time.Now()
+	}
+	serverTime, err := s.serverTime(ctx)
+	if err != nil {
+		log.Printf("Error: Unable to get server time, using local time: %v", err)
+		return time.Now()
+	}
+	return serverTime
 }
 
 func (s *Service) collectionExists(ctx context.Context, collection string) bool {
-	if keywordExistsIn(collection, s.existingCollections) {
+	if s.existingCollections.Contains(collection) {
 		return true
 	}
 	// Update existing collections & check again, in case new ones were added
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
 	collections, err := s.database.ListCollectionNames(ctx, bson.D{})
 	if err != nil {
 		log.Printf("Error: Unable get collections list")
 		return false
 	}
-	s.existingCollections = collections
-	return keywordExistsIn(collection, collections)
+	s.existingCollections.Replace(collections)
+	return s.existingCollections.Contains(collection)
 }
 
-// createIndexes adds these indexes on collection:
+// videoIndexes are the indexes every keyword collection needs:
 // Single field Index on PublishedAt to keep docs in reverse chronological order
 // Text Index on Title and Description for search
 // Unique Index on YoutubeId so we don't add duplicates
-func (s *Service) createIndexes(ctx context.Context, collection *mongo.Collection) {
-	publishedAtIndex := mongo.IndexModel{Keys: bson.D{{"publishedAt", -1}}}
-	textIndex := mongo.IndexModel{Keys: bson.D{
-		{"title", "text"},
-		{"description", "text"},
-	}}
+func (s *Service) videoIndexes() []mongo.IndexModel {
+	publishedAtIndex := mongo.IndexModel{Keys: bson.D{{Key: "publishedAt", Value: -1}}}
 	youtubeIdIndex := mongo.IndexModel{
-		Keys:    bson.D{{"youtubeId", 1}},
+		Keys:    bson.D{{Key: "youtubeId", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	}
+	indexes := []mongo.IndexModel{publishedAtIndex, s.textIndex(), youtubeIdIndex}
+	if s.sharedStorage {
+		keywordsIndex := mongo.IndexModel{Keys: bson.D{{Key: "keywords", Value: 1}, {Key: "publishedAt", Value: -1}}}
+		indexes = append(indexes, keywordsIndex)
+	}
+	return indexes
+}
+
+// textIndex indexes title and description for search, by default with
+// english stemming and stop words.
+func (s *Service) textIndex() mongo.IndexModel {
+	textOptions := options.Index()
+	if s.textLanguage != "" {
+		textOptions.SetDefaultLanguage(s.textLanguage)
+	}
+	if s.languageOverride != "" {
+		textOptions.SetLanguageOverride(s.languageOverride)
+	}
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "title", Value: "text"},
+			{Key: "description", Value: "text"},
+		},
+		Options: textOptions,
+	}
+}
+
+// createIndexes adds videoIndexes on collection.
+func (s *Service) createIndexes(ctx context.Context, collection *mongo.Collection) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
 	indexes := collection.Indexes()
-	names, err := indexes.CreateMany(ctx, []mongo.IndexModel{publishedAtIndex, textIndex, youtubeIdIndex})
+	names, err := indexes.CreateMany(ctx, s.videoIndexes())
 	if err != nil {
-		log.Println("Error: Failed to create indexes")
+		log.Printf("Error: Failed to create indexes: %v", err)
 		return
 	}
 	log.Printf("Successfully created indexes: %v", names)
 }
 
-func (s *Service) saveVideosToDB(ctx context.Context, searchKey string, videos []interface{}) {
-	collectionPreviouslyExists := s.collectionExists(ctx, searchKey)
-	collection := s.database.Collection(searchKey)
+// verifyIndexes warns about the videoIndexes missing on collection, for when
+// they're managed by an admin instead of the worker.
+func (s *Service) verifyIndexes(ctx context.Context, collection *mongo.Collection) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		log.Printf("Error: Unable to list indexes of %s: %v", collection.Name(), err)
+		return
+	}
+	var existing []struct {
+		Key    bson.D `bson:"key"`
+		Unique bool   `bson:"unique"`
+	}
+	if err := cursor.All(ctx, &existing); err != nil {
+		log.Printf("Error: Unable to decode indexes of %s: %v", collection.Name(), err)
+		return
+	}
+
+	var missing []string
+	for _, index := range s.videoIndexes() {
+		want := indexSignature(index.Keys.(bson.D))
+		unique := index.Options != nil && index.Options.Unique != nil && *index.Options.Unique
+		found := false
+		for _, e := range existing {
+			if indexSignature(e.Key) == want && (e.Unique || !unique) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, want)
+		}
+	}
+	if len(missing) != 0 {
+		log.Printf("Warning: %s is missing indexes on %s. Searches and inserts will be slow, and duplicates won't be rejected until an admin creates them",
+			collection.Name(), strings.Join(missing, ", "))
+	}
+}
+
+// indexSignature names an index by its keyed fields, or "text" for text
+// indexes, whose key mongo stores as _fts/_ftsx instead of the indexed fields.
+func indexSignature(keys bson.D) string {
+	var fields []string
+	for _, k := range keys {
+		if k.Value == "text" || k.Key == "_fts" {
+			return "text"
+		}
+		fields = append(fields, k.Key)
+	}
+	return strings.Join(fields, ",")
+}
+
+// withinDocumentLimit drops the videos mongo would reject for exceeding its
+// document size limit, so a single pathological video doesn't fail the batch.
+func withinDocumentLimit(videos []interface{}) []interface{} {
+	var valid []interface{}
+	for _, v := range videos {
+		video, _ := v.(model.Video)
+		doc, err := bson.Marshal(v)
+		if err != nil {
+			log.Printf("Error: Unable to encode video %s, skipping: %v", video.YoutubeID, err)
+			continue
+		}
+		if len(doc) > maxDocumentSize {
+			log.Printf("Error: Video %s is %d bytes, over the %d byte document limit, skipping", video.YoutubeID, len(doc), maxDocumentSize)
+			continue
+		}
+		valid = append(valid, v)
+	}
+	return valid
+}
+
+// saveVideosToDB upserts videos into the searchKey collection. It returns how
+// many were inserted and how many were already stored and got updated.
+func (s *Service) saveVideosToDB(ctx context.Context, searchKey string, videos []interface{}) (inserted, duplicates int, err error) {
+	if s.compress {
+		for i, v := range videos {
+			video, _ := v.(model.Video)
+			if err := video.CompressDescription(); err != nil {
+				log.Printf("Error: Unable to compress description of %s, storing it uncompressed: %v", video.YoutubeID, err)
+				continue
+			}
+			videos[i] = video
+		}
+	}
+	videos = withinDocumentLimit(videos)
+	if len(videos) == 0 {
+		return 0, 0, nil
+	}
+
+	name := s.storageCollection(searchKey)
+	// Tags the videos with their keyword in the shared collection
+	keyword := ""
+	if s.sharedStorage {
+		keyword = searchKey
+	}
+	collectionPreviouslyExists := s.collectionExists(ctx, name)
+	collection := s.database.Collection(name)
 	if !collectionPreviouslyExists {
-		s.createIndexes(ctx, collection)
+		if s.unmanagedIndexes {
+			s.verifyIndexes(ctx, collection)
+		} else {
+			s.createIndexes(ctx, collection)
+		}
+	}
+
+	// Keep going when a chunk fails, so one bad write doesn't lose the rest
+	failedChunks := 0
+	numChunks := (len(videos) + s.insertBatchSize - 1) / s.insertBatchSize
+	for i := 0; i < numChunks; i++ {
+		start := i * s.insertBatchSize
+		end := start + s.insertBatchSize
+		if end > len(videos) {
+			end = len(videos)
+		}
+		chunk := videos[start:end]
+		chunkCtx, cancel := s.dbContext(ctx)
+		chunkInserted, chunkDuplicates, chunkErr := upsertChunk(chunkCtx, collection, chunk, keyword, s.updateMutableFields, time.Now())
+		cancel()
+		inserted += chunkInserted
+		duplicates += chunkDuplicates
+		if chunkErr != nil {
+			first, _ := chunk[0].(model.Video)
+			last, _ := chunk[len(chunk)-1].(model.Video)
+			log.Printf("Error: Chunk %d/%d (videos %d-%d, %s to %s) failed: %v",
+				i+1, numChunks, start, end-1, first.YoutubeID, last.YoutubeID, chunkErr)
+			failedChunks++
+			err = chunkErr
+		}
 	}
+	logging.Info("saved videos", "collection", searchKey, "inserted", inserted, "updated", duplicates,
+		"failed_chunks", failedChunks, "chunks", numChunks)
+	if failedChunks != 0 {
+		return inserted, duplicates, fmt.Errorf("%d of %d chunks failed, last error: %w", failedChunks, numChunks, err)
+	}
+	return inserted, duplicates, nil
+}
+
+// mutableFields are the video fields refreshed every time a stored video is
+// seen again. Everything else keeps the value it was first stored with.
+var mutableFields = map[string]bool{
+	"title":                 true,
+	"description":           true,
+	"descriptionGzip":       true,
+	"descriptionCompressed": true,
+	"thumbnailUrl":          true,
+	"thumbnails":            true,
+	"liveBroadcastContent":  true,
+	"viewCount":             true,
+	"likeCount":             true,
+	"commentCount":          true,
+	"enriched":              true,
+	"fetchTiming":           true,
+}
 
-	_, err := collection.InsertMany(ctx, videos, options.InsertMany().SetOrdered(false))
+// videoUpsert returns the update storing video as is when it's new, and
+// refreshing its mutableFields when it's already stored unless refresh is
+// false. firstSeenAt is only set on insert. A keyword is added to the video's
+// keywords, for the shared collection.
+func videoUpsert(video model.Video, keyword string, refresh bool, firstSeenAt time.Time) (mongo.WriteModel, error) {
+	raw, err := bson.Marshal(video)
 	if err != nil {
-		// This could be triggered when inserting duplicates but shouldn't be a problem
-		// as other values are inserted with ordered set to false.
-		log.Printf("Error: DB update failed: %v", err)
-		return
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "_id")
+
+	set := bson.M{}
+	onInsert := bson.M{"firstSeenAt": firstSeenAt}
+	for field, value := range doc {
+		if refresh && mutableFields[field] {
+			set[field] = value
+		} else {
+			onInsert[field] = value
+		}
+	}
+	update := bson.M{"$setOnInsert": onInsert}
+	if len(set) != 0 {
+		update["$set"] = set
+	}
+	// Drop the plain description of videos stored before COMPRESS_DESCRIPTIONS was on
+	if refresh && video.DescriptionCompressed {
+		update["$unset"] = bson.M{"description": ""}
 	}
-	log.Printf("Inserted %d documents to db", len(videos))
+	if keyword != "" {
+		update["$addToSet"] = bson.M{"keywords": keyword}
+	}
+	return mongo.NewUpdateOneModel().
+		SetFilter(bson.M{"youtubeId": video.YoutubeID}).
+		SetUpdate(update).
+		SetUpsert(true), nil
 }
 
-func main() {
-	if len(os.Args) == 1 {
-		log.Fatal("Missing search term, send as argument")
+// upsertChunk upserts videos into collection by youtubeId. It returns how
+// many were inserted and how many were already stored, err is only set for
+// failures other than duplicates, which only happen when another worker
+// inserts the same video at the same time.
+func upsertChunk(ctx context.Context, collection *mongo.Collection, videos []interface{}, keyword string, refresh bool, now time.Time) (inserted, duplicates int, err error) {
+	models := make([]mongo.WriteModel, 0, len(videos))
+	for _, v := range videos {
+		video, _ := v.(model.Video)
+		if video.FetchTiming != nil {
+			// Shared with the caller's copy, for fetchTimingStats
+			video.FetchTiming.LatencyMs = time.Since(video.FetchTiming.SeenAt).Milliseconds()
+		}
+		m, err := videoUpsert(video, keyword, refresh, now)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to encode video %s: %w", video.YoutubeID, err)
+		}
+		models = append(models, m)
+	}
+	result, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if result != nil {
+		inserted = int(result.UpsertedCount)
+		duplicates = int(result.MatchedCount)
 	}
-	searchTerm := os.Args[1]
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) {
+			return inserted, duplicates, err
+		}
+		// Duplicate keys are videos upserted by another worker at the same
+		// time, they're stored either way. Anything else lost a video.
+		raced := 0
+		failedCodes := map[int]int{}
+		var firstFailure *mongo.WriteError
+		for i, we := range bulkErr.WriteErrors {
+			if mongo.IsDuplicateKeyError(we) {
+				raced++
+				continue
+			}
+			failedCodes[we.Code]++
+			if firstFailure == nil {
+				firstFailure = &bulkErr.WriteErrors[i].WriteError
+			}
+		}
+		duplicates += raced
+		if raced != 0 {
+			logging.Info("duplicate key on upsert", "collection", collection.Name(), "count", raced)
+		}
+		failed := len(bulkErr.WriteErrors) - raced
+		if failed != 0 {
+			logging.Error("failed to write videos", "collection", collection.Name(), "count", failed,
+				"of", len(models), "codes", writeErrorCodes(failedCodes))
+		}
+		switch {
+		case bulkErr.WriteConcernError != nil:
+			return inserted, duplicates, fmt.Errorf("write concern error: %v", bulkErr.WriteConcernError)
+		case firstFailure != nil:
+			return inserted, duplicates, fmt.Errorf("%d of %d videos failed to write, first: %v", failed, len(models), firstFailure)
+		}
+	}
+	return inserted, duplicates, nil
+}
 
-	apiKey := os.Getenv("API_KEY")
-	if apiKey == "" {
-		log.Fatal("Missing API_KEY")
+// writeErrorCodes formats the count of write errors per code as
+// "code:count,…" sorted by code so the logs of a repeating failure match.
+func writeErrorCodes(counts map[int]int) string {
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%d:%d", code, counts[code])
+	}
+	return strings.Join(parts, ",")
+}
+
+var (
+	regionCodeRegex = regexp.MustCompile(`^[A-Za-z]{2}$`)
+	languageRegex   = regexp.MustCompile(`^[a-z]{2}(-[A-Za-z]+)?$`)
+)
+
+// loadOptions sets the optional behaviour configured through env variables.
+func (s *Service) loadOptions() {
+	s.traceWindows = os.Getenv("TRACE_WINDOWS") == "true"
+	s.roundPublishedAt = os.Getenv("ROUND_PUBLISHED_AT") == "true"
+	s.completeWindows = os.Getenv("COMPLETE_WINDOWS") == "true"
+	s.compress = os.Getenv("COMPRESS_DESCRIPTIONS") == "true"
+	s.useServerTime = os.Getenv("USE_SERVER_TIME") == "true"
+	s.recordMetrics = os.Getenv("RECORD_METRICS") == "true"
+	s.recordFetchTiming = os.Getenv("RECORD_FETCH_TIMING") == "true"
+	s.textLanguage = os.Getenv("TEXT_INDEX_LANGUAGE")
+	s.instanceName = os.Getenv("INSTANCE_NAME")
+	s.unmanagedIndexes = os.Getenv("MANAGE_INDEXES") == "false"
+	s.sharedStorage = mongoenv.SharedStorage()
+	s.updateMutableFields = os.Getenv("UPDATE_MUTABLE_FIELDS") != "false"
+	switch eventType := os.Getenv("EVENT_TYPE"); eventType {
+	case "", "none":
+	case "live", "upcoming", "completed":
+		s.eventType = eventType
+	default:
+		log.Printf("EVENT_TYPE must be live, upcoming, completed or none. Ignoring %s", eventType)
+	}
+	switch videoDuration := os.Getenv("VIDEO_DURATION"); videoDuration {
+	case "", "any":
+	case "short", "medium", "long":
+		s.videoDuration = videoDuration
+	default:
+		log.Printf("VIDEO_DURATION must be short, medium, long or any. Ignoring %s", videoDuration)
+	}
+	if regionCode := os.Getenv("REGION_CODE"); regionCode != "" {
+		if regionCodeRegex.MatchString(regionCode) {
+			s.regionCode = strings.ToUpper(regionCode)
+		} else {
+			log.Printf("REGION_CODE must be a two letter ISO 3166-1 country code, eg: IN. Ignoring %s", regionCode)
+		}
+	}
+	if language := os.Getenv("RELEVANCE_LANGUAGE"); language != "" {
+		if languageRegex.MatchString(language) {
+			s.relevanceLanguage = language
+		} else {
+			log.Printf("RELEVANCE_LANGUAGE must be an ISO 639-1 language code, eg: en or zh-Hans. Ignoring %s", language)
+		}
+	}
+	switch videoCaption := os.Getenv("VIDEO_CAPTION"); videoCaption {
+	case "", "any":
+	case "closedCaption", "none":
+		s.videoCaption = videoCaption
+	default:
+		log.Printf("VIDEO_CAPTION must be closedCaption, none or any. Ignoring %s", videoCaption)
+	}
+	s.insertBatchSize = defaultInsertBatchSize
+	if n, err := strconv.Atoi(os.Getenv("INSERT_BATCH_SIZE")); err == nil && n > 0 {
+		s.insertBatchSize = n
 	}
+	s.languageOverride = os.Getenv("TEXT_INDEX_LANGUAGE_OVERRIDE")
 
-	mongoURI := os.Getenv("MONGO_URI")
+	s.maxResults = searchPageSize
+	if maxResults := os.Getenv("MAX_RESULTS"); maxResults != "" {
+		n, err := strconv.ParseInt(maxResults, 10, 64)
+		if err != nil || n < 1 || n > searchPageSize {
+			log.Printf("MAX_RESULTS must be between 1 and %d. Defaulting to %d", searchPageSize, searchPageSize)
+		} else {
+			s.maxResults = n
+		}
+	}
+	s.dbTimeout = defaultDBTimeout
+	if dbTimeout := os.Getenv("DB_TIMEOUT"); dbTimeout != "" {
+		n, err := strconv.Atoi(dbTimeout)
+		if err != nil || n < 1 {
+			log.Printf("DB_TIMEOUT must be a positive number of seconds. Defaulting to %v", defaultDBTimeout)
+		} else {
+			s.dbTimeout = time.Duration(n) * time.Second
+		}
+	}
+	s.retryPolicy = retryPolicy{defaultRetryAttempts, defaultRetryDelay, defaultRetryMaxDelay}
+	if attempts := os.Getenv("RETRY_ATTEMPTS"); attempts != "" {
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n < 1 {
+			log.Printf("RETRY_ATTEMPTS must be at least 1. Defaulting to %d", defaultRetryAttempts)
+		} else {
+			s.retryPolicy.attempts = n
+		}
+	}
+	if delay := os.Getenv("RETRY_DELAY"); delay != "" {
+		n, err := strconv.Atoi(delay)
+		if err != nil || n < 0 {
+			log.Printf("RETRY_DELAY must be a number of seconds. Defaulting to %v", defaultRetryDelay)
+		} else {
+			s.retryPolicy.delay = time.Duration(n) * time.Second
+		}
+	}
+	if maxDelay := os.Getenv("RETRY_MAX_DELAY"); maxDelay != "" {
+		n, err := strconv.Atoi(maxDelay)
+		if err != nil || n < 0 {
+			log.Printf("RETRY_MAX_DELAY must be a number of seconds. Defaulting to %v", defaultRetryMaxDelay)
+		} else {
+			s.retryPolicy.maxDelay = time.Duration(n) * time.Second
+		}
+	}
+	if dailyQuota := os.Getenv("DAILY_QUOTA"); dailyQuota != "" {
+		n, err := strconv.Atoi(dailyQuota)
+		if err != nil || n < 1 {
+			log.Printf("DAILY_QUOTA must be a positive number of units. Not limiting quota use")
+		} else {
+			s.quota.limit = n
+		}
+	}
+	s.maxPages = defaultMaxPages
+	if maxPages := os.Getenv("MAX_PAGES"); maxPages != "" {
+		n, err := strconv.Atoi(maxPages)
+		if err != nil || n < 1 {
+			log.Printf("MAX_PAGES must be at least 1. Defaulting to %d", defaultMaxPages)
+		} else {
+			s.maxPages = n
+		}
+	}
+}
+
+func mongoFromEnv() (mongoURI, mongoDbName string) {
+	mongoURI = os.Getenv("MONGO_URI")
 	if mongoURI == "" {
 		mongoURI = "mongodb://0.0.0.0:27017"
 	}
 
-	mongoDbName := os.Getenv("MONGO_DB")
+	mongoDbName = os.Getenv("MONGO_DB")
 	if mongoDbName == "" {
 		log.Fatal("MONGO_DB missing")
 	}
+	return mongoURI, mongoDbName
+}
+
+// newFromEnv sets up the Service from env variables, failing fast on
+// misconfiguration.
+func newFromEnv(ctx context.Context) *Service {
+	mongoURI, mongoDbName := mongoFromEnv()
+	s := New(ctx, apiKeysFromEnv(), mongoURI, mongoDbName)
+	s.loadOptions()
+	if os.Getenv("CHECK_PRIVILEGES") != "false" {
+		if err := s.checkPrivileges(ctx); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	if s.recordMetrics {
+		ttlDays, err := strconv.Atoi(os.Getenv("METRICS_TTL_DAYS"))
+		if err != nil {
+			ttlDays = 30
+		}
+		s.createMetricsIndex(ctx, ttlDays)
+	}
+	return s
+}
+
+// parseArgs parses fs allowing flags before and after the positional args,
+// and returns the positional args.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
 
+// pollIntervalFromEnv returns POLL_INTERVAL in seconds.
+func pollIntervalFromEnv() int {
 	pollInterval, err := strconv.Atoi(os.Getenv("POLL_INTERVAL"))
 	if err != nil {
 		pollInterval = 10
 		log.Printf("Unable to set polling interval. Defaulting to %d seconds", pollInterval)
 	}
+	return pollInterval
+}
 
-	ctx := context.Background()
-	s := New(ctx, apiKey, mongoURI, mongoDbName)
+// searchConfig is how a search term is polled.
+type searchConfig struct {
+	// Seconds between polls
+	Interval int `json:"interval"`
+	// Results requested per search call, MAX_RESULTS when 0
+	MaxResults int64 `json:"maxResults"`
+}
+
+// UnmarshalJSON reads a searchConfig object, or just its interval as a number.
+func (c *searchConfig) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &c.Interval); err == nil {
+		return nil
+	}
+	type plain searchConfig
+	return json.Unmarshal(b, (*plain)(c))
+}
 
-	var lastFetchedTime time.Time
+// searchConfigFromEnv returns how every search term in the SEARCH_CONFIG JSON
+// object is polled, e.g. {"breaking news": 30, "cats": {"interval": 600,
+// "maxResults": 10}}. Terms without a positive interval get defaultInterval,
+// and ones without a maxResults of 1 to 50 the MAX_RESULTS one.
+func searchConfigFromEnv(defaultInterval int) map[string]searchConfig {
+	config := map[string]searchConfig{}
+	value := os.Getenv("SEARCH_CONFIG")
+	if value == "" {
+		return config
+	}
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		log.Fatalf("SEARCH_CONFIG must be a JSON object of search terms to poll intervals in seconds, or to {interval, maxResults}: %v", err)
+	}
+	for term, c := range config {
+		if c.Interval < 1 {
+			log.Printf("SEARCH_CONFIG interval of %q must be a positive number of seconds. Defaulting to %d", term, defaultInterval)
+			c.Interval = defaultInterval
+		}
+		if c.MaxResults != 0 && (c.MaxResults < 1 || c.MaxResults > searchPageSize) {
+			log.Printf("SEARCH_CONFIG maxResults of %q must be between 1 and %d. Defaulting to MAX_RESULTS", term, searchPageSize)
+			c.MaxResults = 0
+		}
+		config[term] = c
+	}
+	return config
+}
+
+// pollAll polls every search term in its own goroutine with its own config,
+// until ctx is done.
+func pollAll(ctx context.Context, s *Service, configs map[string]searchConfig) {
+	var polls sync.WaitGroup
+	for term, config := range configs {
+		polls.Add(1)
+		go func(term string, config searchConfig) {
+			defer polls.Done()
+			poll(ctx, s, term, config)
+		}(term, config)
+	}
+	polls.Wait()
+}
+
+// poll fetches and stores videos for searchTerm every config.Interval seconds,
+// until ctx is done. It returns once the saves it started are finished.
+func poll(ctx context.Context, s *Service, searchTerm string, config searchConfig) {
+	pollInterval := config.Interval
+	fetch := s.fetcherFor(config)
+	baseInterval := time.Duration(pollInterval) * time.Second
+	interval := baseInterval
+	adaptive := os.Getenv("ADAPTIVE_POLLING") == "true"
+	maxInterval := 10 * baseInterval
+	if n, err := strconv.Atoi(os.Getenv("MAX_POLL_INTERVAL")); err == nil && n >= pollInterval {
+		maxInterval = time.Duration(n) * time.Second
+	}
+
+	s.checkClockSkew(ctx)
+	collection := s.collectionFor(ctx, searchTerm)
+	if stored := s.storageCollection(collection); s.unmanagedIndexes && s.collectionExists(ctx, stored) {
+		s.verifyIndexes(ctx, s.database.Collection(stored))
+	}
+
+	streak := emptyStreak{keyword: searchTerm, webhookURL: os.Getenv("ALERT_WEBHOOK_URL")}
+	if v := os.Getenv("ALERT_AFTER_EMPTY_CYCLES"); v != "" {
+		var err error
+		if streak.threshold, err = strconv.Atoi(v); err != nil {
+			log.Printf("Unable to set ALERT_AFTER_EMPTY_CYCLES. Alerts are disabled")
+		}
+	}
+
+	// Saves don't stop with ctx, so the ones in flight on shutdown can finish
+	saveCtx := context.Background()
+	var saves sync.WaitGroup
+	save := func(videos []interface{}, cycle cycleMetrics) {
+		saves.Add(1)
+		go func() {
+			defer saves.Done()
+			s.save(saveCtx, collection, videos, cycle)
+		}()
+	}
+	var coalescer *saveCoalescer
+	if window, err := strconv.Atoi(os.Getenv("SAVE_COALESCE_WINDOW")); err == nil && window > 0 {
+		coalescer = &saveCoalescer{s: s, collection: collection, window: time.Duration(window) * time.Second}
+		save = func(videos []interface{}, cycle cycleMetrics) { coalescer.add(saveCtx, videos, cycle) }
+	}
+	defer func() {
+		log.Println("Shutting down, waiting for pending saves")
+		if coalescer != nil {
+			coalescer.close(saveCtx)
+		}
+		saves.Wait()
+		log.Printf("Stopped, %v", &s.saves)
+	}()
+
+	s.savePollInterval(ctx, searchTerm, interval)
+	mark := &watermark{
+		t: s.lastFetchedTime(ctx, searchTerm),
+		persist: func(t time.Time) {
+			s.saveLastFetchedTime(saveCtx, searchTerm, t)
+		},
+	}
 	for {
-		videos := s.fetchVideos(searchTerm, lastFetchedTime)
+		videos, cycle, err := s.pollCycle(ctx, searchTerm, mark, fetch)
 		numVideos := len(videos)
-		log.Println("FETCHED:", numVideos)
-		if numVideos != 0 {
-			go s.saveVideosToDB(ctx, searchTerm, videos)
+		s.fetching.Lock()
+		quotaLeft, quotaResetAt := s.quota.remaining(time.Now()), s.quota.resetAt
+		s.fetching.Unlock()
+		save(videos, cycle)
+		streak.observe(numVideos, time.Now())
+		if adaptive {
+			next := adaptInterval(interval, baseInterval, maxInterval, numVideos)
+			if next != interval {
+				log.Printf("Polling interval is now %v", next)
+				s.savePollInterval(ctx, searchTerm, next)
+			}
+			interval = next
+		}
+		wait := interval
+		if s.quota.limit != 0 {
+			logging.Info("quota left", "search_key", searchTerm, "units", quotaLeft, "daily_quota", s.quota.limit)
+		}
+		if errors.Is(err, errDailyQuotaReached) {
+			// Search again from the same point once the quota is reset
+			wait = time.Until(quotaResetAt)
+			logging.Warn("DAILY_QUOTA reached, pausing polling", "search_key", searchTerm, "until", quotaResetAt)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// fetcher gets the videos of searchKey published between since and before,
+// like fetchWindow.
+type fetcher func(ctx context.Context, searchKey string, since, before time.Time) ([]interface{}, error)
+
+// fetcherFor returns the fetch of the poll cycles of a term with config,
+// requesting its maxResults per search call, or MAX_RESULTS without one.
+func (s *Service) fetcherFor(config searchConfig) fetcher {
+	maxResults := s.maxResults
+	if config.MaxResults != 0 {
+		maxResults = config.MaxResults
+	}
+	return func(ctx context.Context, searchKey string, since, before time.Time) ([]interface{}, error) {
+		return s.fetchWindow(ctx, searchKey, since, before, maxResults)
+	}
+}
+
+// pollCycle fetches the videos of searchTerm published from mark to now,
+// returning them with the cycle's metrics for saving. Saving it moves mark to
+// the end of its window, unless it failed.
+func (s *Service) pollCycle(ctx context.Context, searchTerm string, mark *watermark, fetch fetcher) ([]interface{}, cycleMetrics, error) {
+	cycle := cycleMetrics{Keyword: searchTerm, Ts: time.Now(), mark: mark}
+	// One term fetches at a time, as they share the API keys and quota
+	s.fetching.Lock()
+	quotaUsed := s.quotaUsed
+	// The window searched, traced on the videos and saved as the watermark
+	// all end at the same time, from mongo's clock with USE_SERVER_TIME
+	cycle.windowEnd = s.now(ctx)
+	videos, err := fetch(ctx, searchTerm, mark.get(), cycle.windowEnd)
+	cycle.QuotaUsed = s.quotaUsed - quotaUsed
+	s.fetching.Unlock()
+	logging.Info("fetched videos", "search_key", searchTerm, "count", len(videos))
+	cycle.Fetched = len(videos)
+	if err != nil {
+		cycle.Error = err.Error()
+	}
+	return videos, cycle, err
+}
+
+// adaptInterval doubles the polling interval after a cycle without new
+// videos, up to max, and goes back to base as soon as videos show up.
+func adaptInterval(current, base, max time.Duration, fetched int) time.Duration {
+	if fetched != 0 {
+		return base
+	}
+	if current*2 > max {
+		return max
+	}
+	return current * 2
+}
+
+// fetch runs the fetch subcommand:
+//
+//	worker fetch [--once [--json]] <searchTerm>
+//
+// Without --once it polls like the default mode. --once does a single fetch,
+// records the run in the runs collection and exits, non-zero on failure.
+// With --json the videos are printed to stdout instead of stored.
+func fetch(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	once := fs.Bool("once", false, "fetch a single time and exit")
+	asJSON := fs.Bool("json", false, "print the fetched videos as JSON instead of storing them, requires --once")
+	positional := parseArgs(fs, args)
+	if len(positional) != 1 {
+		log.Fatal("Usage: worker fetch [--once [--json]] <searchTerm>")
+	}
+	searchTerm := positional[0]
+	if *asJSON && !*once {
+		log.Fatal("--json requires --once")
+	}
+
+	if *asJSON {
+		apiKeys, err := newAPIKeys(apiKeysFromEnv())
+		if err != nil {
+			log.Fatalf("Error creating new YouTube client: %v", err)
+		}
+		s := &Service{apiKeys: apiKeys}
+		s.loadOptions()
+		if err := s.printVideos(ctx, os.Stdout, searchTerm); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	s := newFromEnv(ctx)
+	if !*once {
+		poll(ctx, s, searchTerm, searchConfig{Interval: pollIntervalFromEnv()})
+		return
+	}
+
+	run := runRecord{Mode: "once", Keyword: searchTerm, StartedAt: time.Now()}
+	videos, err := s.fetchVideos(ctx, searchTerm, time.Time{})
+	logging.Info("fetched videos", "search_key", searchTerm, "count", len(videos))
+	run.Fetched = len(videos)
+	if len(videos) != 0 {
+		var saveErr error
+		run.Inserted, _, saveErr = s.saveVideosToDB(ctx, s.collectionFor(ctx, searchTerm), videos)
+		if err == nil {
+			err = saveErr
+		}
+	}
+	s.finishRun(ctx, run, err)
+}
+
+// printVideos fetches the videos of searchTerm and writes them to w as a JSON
+// array, which is empty when there are none. The ones fetched before a failure
+// are still written.
+func (s *Service) printVideos(ctx context.Context, w io.Writer, searchTerm string) error {
+	videos, fetchErr := s.fetchVideos(ctx, searchTerm, time.Time{})
+	if videos == nil {
+		videos = []interface{}{}
+	}
+	if err := json.NewEncoder(w).Encode(videos); err != nil {
+		log.Fatalf("Error: Unable to write videos: %v", err)
+	}
+	return fetchErr
+}
+
+func main() {
+	logging.Setup()
+	if len(os.Args) == 1 && os.Getenv("SEARCH_CONFIG") == "" {
+		log.Fatal("Missing search term, send as argument or set SEARCH_CONFIG")
+	}
+
+	ctx := context.Background()
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "validate":
+		mongoURI, mongoDbName := mongoFromEnv()
+		if !validate(ctx, apiKeysFromEnv(), mongoURI, mongoDbName) {
+			os.Exit(1)
+		}
+	case "fetch":
+		fetch(ctx, os.Args[2:])
+	case "reindex":
+		newFromEnv(ctx).reindex(ctx, os.Args[2:])
+	case "dedupe":
+		newFromEnv(ctx).dedupe(ctx, os.Args[2:])
+	case "backfill":
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		newFromEnv(ctx).backfill(ctx, os.Args[2:])
+	default:
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		s := newFromEnv(ctx)
+		pollInterval := pollIntervalFromEnv()
+		configs := searchConfigFromEnv(pollInterval)
+		if command != "" {
+			if _, ok := configs[command]; !ok {
+				configs[command] = searchConfig{Interval: pollInterval}
+			}
+		}
+		pollAll(ctx, s, configs)
+		if err := s.mongoClient.Disconnect(context.Background()); err != nil {
+			log.Printf("Error: Unable to disconnect from mongo: %v", err)
 		}
-		lastFetchedTime = time.Now()
-		time.Sleep(time.Duration(pollInterval) * time.Second)
 	}
 }
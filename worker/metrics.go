@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// metricsCollection holds a cycleMetrics record per poll cycle when RECORD_METRICS=true
+const metricsCollection = "_metrics"
+
+type cycleMetrics struct {
+	Keyword    string    `bson:"keyword"`
+	Ts         time.Time `bson:"ts"`
+	Fetched    int       `bson:"fetched"`
+	Inserted   int       `bson:"inserted"`
+	Duplicates int       `bson:"duplicates"`
+	DurationMs int64     `bson:"durationMs"`
+	QuotaUsed  int       `bson:"quotaUsed"`
+	Error      string    `bson:"error,omitempty"`
+
+	// End of the poll window, which mark advances to once it's all stored
+	windowEnd time.Time
+	mark      *watermark
+}
+
+// createMetricsIndex expires metrics records ttlDays after they're written.
+func (s *Service) createMetricsIndex(ctx context.Context, ttlDays int) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	ttlIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "ts", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(ttlDays * 24 * 60 * 60)),
+	}
+	if _, err := s.database.Collection(metricsCollection).Indexes().CreateOne(ctx, ttlIndex); err != nil {
+		log.Printf("Error: Failed to create metrics TTL index: %v", err)
+	}
+}
+
+// tallyLogInterval is every how many saves the saveTally is logged.
+const tallyLogInterval = 10
+
+// saveTally counts the outcome of every save since the worker started. Saves
+// run in their own goroutines, so it's updated atomically.
+type saveTally struct {
+	succeeded  atomic.Int64
+	failed     atomic.Int64
+	inserted   atomic.Int64
+	duplicates atomic.Int64
+}
+
+// record adds a save's outcome and returns how many saves there were so far.
+func (t *saveTally) record(inserted, duplicates int, err error) int64 {
+	t.inserted.Add(int64(inserted))
+	t.duplicates.Add(int64(duplicates))
+	if err != nil {
+		t.failed.Add(1)
+	} else {
+		t.succeeded.Add(1)
+	}
+	return t.succeeded.Load() + t.failed.Load()
+}
+
+func (t *saveTally) String() string {
+	return fmt.Sprintf("%d saves succeeded, %d failed, %d videos inserted, %d duplicates",
+		t.succeeded.Load(), t.failed.Load(), t.inserted.Load(), t.duplicates.Load())
+}
+
+// save stores the videos fetched in a poll cycle and records the cycle's
+// metrics when enabled.
+func (s *Service) save(ctx context.Context, collection string, videos []interface{}, cycle cycleMetrics) {
+	if len(videos) != 0 {
+		var err error
+		cycle.Inserted, cycle.Duplicates, err = s.saveVideosToDB(ctx, collection, videos)
+		saves := s.saves.record(cycle.Inserted, cycle.Duplicates, err)
+		if err != nil {
+			cycle.Error = err.Error()
+			log.Printf("Error: Unable to save videos to %s: %v. So far %v", collection, err, &s.saves)
+		} else if saves%tallyLogInterval == 0 {
+			log.Printf("So far %v", &s.saves)
+		}
+	}
+	if stats, ok := fetchTimingStats(videos, time.Now()); ok {
+		s.saveFetchTiming(ctx, cycle.Keyword, stats)
+	}
+	// A failed fetch or save leaves the window to be fetched again
+	if cycle.Error == "" && cycle.mark != nil && !cycle.windowEnd.IsZero() {
+		cycle.mark.advance(cycle.windowEnd)
+	}
+	if !s.recordMetrics {
+		return
+	}
+	cycle.DurationMs = time.Since(cycle.Ts).Milliseconds()
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	if _, err := s.database.Collection(metricsCollection).InsertOne(ctx, cycle); err != nil {
+		log.Printf("Error: Unable to record metrics: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSaveRecordsMetricsPerCycle(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name    string
+		record  bool
+		cycles  []cycleMetrics
+		wantErr []string
+	}{
+		{"disabled", false, []cycleMetrics{{Keyword: "cats"}}, nil},
+		{
+			"a record per cycle",
+			true,
+			[]cycleMetrics{{Keyword: "cats", Fetched: 0}, {Keyword: "cats", Error: "unable to search"}},
+			[]string{"", "unable to search"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := &Service{database: mt.DB, recordMetrics: tt.record}
+			for _, cycle := range tt.cycles {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+				cycle.Ts = time.Now()
+				s.save(context.Background(), "cats", nil, cycle)
+			}
+
+			var inserts []string
+			for _, e := range mt.GetAllStartedEvents() {
+				if e.CommandName != "insert" {
+					continue
+				}
+				if coll := e.Command.Lookup("insert").StringValue(); coll != metricsCollection {
+					mt.Errorf("inserted into %s, want %s", coll, metricsCollection)
+				}
+				doc := e.Command.Lookup("documents").Array().Index(0).Value().Document()
+				if got := doc.Lookup("keyword").StringValue(); got != "cats" {
+					mt.Errorf("keyword = %q, want cats", got)
+				}
+				errValue, _ := doc.Lookup("error").StringValueOK()
+				inserts = append(inserts, errValue)
+			}
+			if len(inserts) != len(tt.wantErr) {
+				mt.Fatalf("recorded %d cycles, want %d", len(inserts), len(tt.wantErr))
+			}
+			for i := range inserts {
+				if inserts[i] != tt.wantErr[i] {
+					mt.Errorf("cycle %d error = %q, want %q", i, inserts[i], tt.wantErr[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSaveTally(t *testing.T) {
+	var tally saveTally
+	tally.record(3, 1, nil)
+	tally.record(0, 0, errors.New("timeout"))
+	if n := tally.record(2, 0, nil); n != 3 {
+		t.Errorf("record() = %d saves, want 3", n)
+	}
+	if got, want := tally.String(), "2 saves succeeded, 1 failed, 5 videos inserted, 1 duplicates"; got != want {
+		t.Errorf("tally = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestPollCycleOnlyAdvancesOnStoredWindows(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	var persisted []time.Time
+	mark := &watermark{t: start, persist: func(t time.Time) { persisted = append(persisted, t) }}
+
+	// Fails once, then finds nothing
+	var sinces, befores []time.Time
+	fails := 1
+	fetch := func(ctx context.Context, searchKey string, since, before time.Time) ([]interface{}, error) {
+		sinces = append(sinces, since)
+		befores = append(befores, before)
+		if fails > 0 {
+			fails--
+			return nil, errors.New("search failed")
+		}
+		return nil, nil
+	}
+
+	s := &Service{}
+	ctx := context.Background()
+	videos, cycle, err := s.pollCycle(ctx, "cats", mark, fetch)
+	if err == nil || cycle.Error == "" {
+		t.Fatal("want the fetch error")
+	}
+	s.save(ctx, "cats", videos, cycle)
+	if got := mark.get(); !got.Equal(start) {
+		t.Fatalf("watermark moved to %v after a failed fetch, want %v", got, start)
+	}
+	if len(persisted) != 0 {
+		t.Fatalf("persisted %v after a failed fetch", persisted)
+	}
+
+	videos, cycle, err = s.pollCycle(ctx, "cats", mark, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.save(ctx, "cats", videos, cycle)
+	if !sinces[1].Equal(start) {
+		t.Errorf("retry searched since %v, want the failed window's start %v", sinces[1], start)
+	}
+	if !befores[1].Equal(cycle.windowEnd) {
+		t.Errorf("searched until %v, but the window ends at %v", befores[1], cycle.windowEnd)
+	}
+	if got := mark.get(); !got.Equal(cycle.windowEnd) {
+		t.Errorf("watermark = %v, want the stored window's end %v", got, cycle.windowEnd)
+	}
+	if len(persisted) != 1 || !persisted[0].Equal(cycle.windowEnd) {
+		t.Errorf("persisted %v, want just %v", persisted, cycle.windowEnd)
+	}
+}
+
+func TestWatermarkNeverMovesBack(t *testing.T) {
+	now := time.Now()
+	var persisted []time.Time
+	mark := &watermark{t: now, persist: func(t time.Time) { persisted = append(persisted, t) }}
+	mark.advance(now.Add(-time.Minute))
+	mark.advance(now)
+	if !mark.get().Equal(now) || len(persisted) != 0 {
+		t.Errorf("watermark = %v, persisted %v, want it unchanged", mark.get(), persisted)
+	}
+	mark.advance(now.Add(time.Minute))
+	if !mark.get().Equal(now.Add(time.Minute)) || len(persisted) != 1 {
+		t.Errorf("watermark = %v, persisted %v, want it advanced", mark.get(), persisted)
+	}
+}
+
+func TestPollSearchesWithEachTermsMaxResults(t *testing.T) {
+	t.Setenv("MAX_RESULTS", "25")
+	t.Setenv("SEARCH_CONFIG", `{"cats": {"interval": 60, "maxResults": 10}, "dogs": 60, "news": {"interval": 30, "maxResults": 50}}`)
+	want := map[string]string{"cats": "10", "dogs": "25", "news": "50"}
+
+	requested := map[string]string{}
+	s := fakeYoutube(t, func(q url.Values) *youtube.SearchListResponse {
+		requested[q.Get("q")] = q.Get("maxResults")
+		return &youtube.SearchListResponse{}
+	})
+	s.loadOptions()
+	for term, config := range searchConfigFromEnv(60) {
+		mark := &watermark{t: time.Now().Add(-time.Hour), persist: func(time.Time) {}}
+		if _, _, err := s.pollCycle(context.Background(), term, mark, s.fetcherFor(config)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("searched with maxResults %v, want %v", requested, want)
+	}
+}
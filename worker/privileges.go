@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// requiredActions are the privileges the worker needs on its whole database,
+// as new keyword collections get created on the fly. createIndex isn't needed
+// with MANAGE_INDEXES=false.
+var requiredActions = []string{"find", "insert", "update", "createIndex", "listCollections"}
+
+type connectionStatus struct {
+	AuthInfo struct {
+		AuthenticatedUsers          []bson.M `bson:"authenticatedUsers"`
+		AuthenticatedUserPrivileges []struct {
+			Resource struct {
+				AnyResource bool    `bson:"anyResource"`
+				DB          *string `bson:"db"`
+				Collection  *string `bson:"collection"`
+			} `bson:"resource"`
+			Actions []string `bson:"actions"`
+		} `bson:"authenticatedUserPrivileges"`
+	} `bson:"authInfo"`
+}
+
+// missingPrivileges returns the requiredActions the connected user can't
+// perform on every collection of the database.
+func (s *Service) missingPrivileges(ctx context.Context) ([]string, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var status connectionStatus
+	err := s.database.RunCommand(ctx, bson.D{
+		{Key: "connectionStatus", Value: 1},
+		{Key: "showPrivileges", Value: true},
+	}).Decode(&status)
+	if err != nil {
+		return nil, err
+	}
+	// Nobody is authenticated when mongo runs without access control
+	if len(status.AuthInfo.AuthenticatedUsers) == 0 {
+		return nil, nil
+	}
+
+	granted := map[string]bool{}
+	for _, p := range status.AuthInfo.AuthenticatedUserPrivileges {
+		r := p.Resource
+		// An empty db or collection name means any
+		onDatabase := r.DB != nil && (*r.DB == "" || *r.DB == s.database.Name()) &&
+			r.Collection != nil && *r.Collection == ""
+		if !r.AnyResource && !onDatabase {
+			continue
+		}
+		for _, a := range p.Actions {
+			granted[a] = true
+		}
+	}
+
+	var missing []string
+	for _, a := range requiredActions {
+		if a == "createIndex" && s.unmanagedIndexes {
+			continue
+		}
+		if !granted[a] {
+			missing = append(missing, a)
+		}
+	}
+	return missing, nil
+}
+
+// checkPrivileges fails when the mongo user can't do everything the worker needs.
+func (s *Service) checkPrivileges(ctx context.Context) error {
+	missing, err := s.missingPrivileges(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to check database privileges: %w", err)
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("mongo user is missing %s privileges on database %s, grant them (e.g. with the readWrite role) and restart",
+			strings.Join(missing, ", "), s.database.Name())
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMissingPrivileges(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	user := bson.A{bson.D{{Key: "user", Value: "worker"}, {Key: "db", Value: "admin"}}}
+	privilege := func(db, collection string, actions ...string) bson.D {
+		return bson.D{
+			{Key: "resource", Value: bson.D{{Key: "db", Value: db}, {Key: "collection", Value: collection}}},
+			{Key: "actions", Value: stringsToA(actions)},
+		}
+	}
+	tests := []struct {
+		name       string
+		users      bson.A
+		privileges bson.A
+		unmanaged  bool
+		want       []string
+	}{
+		{"no access control", bson.A{}, bson.A{}, false, nil},
+		{"readWrite", user, bson.A{privilege(mtest.TestDb, "", requiredActions...)}, false, nil},
+		{"any database", user, bson.A{privilege("", "", requiredActions...)}, false, nil},
+		{"any resource", user, bson.A{bson.D{
+			{Key: "resource", Value: bson.D{{Key: "anyResource", Value: true}}},
+			{Key: "actions", Value: stringsToA(requiredActions)},
+		}}, false, nil},
+		{"read only", user, bson.A{privilege(mtest.TestDb, "", "find", "listCollections")}, false, []string{"insert", "update", "createIndex"}},
+		{"read only with unmanaged indexes", user, bson.A{privilege(mtest.TestDb, "", "find", "listCollections")}, true, []string{"insert", "update"}},
+		{"other database", user, bson.A{privilege("other", "", requiredActions...)}, false, requiredActions},
+		{"single collection", user, bson.A{privilege(mtest.TestDb, "cats", requiredActions...)}, false, requiredActions},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "authInfo", Value: bson.D{
+				{Key: "authenticatedUsers", Value: tt.users},
+				{Key: "authenticatedUserPrivileges", Value: tt.privileges},
+			}}))
+			s := &Service{database: mt.DB, unmanagedIndexes: tt.unmanaged}
+			got, err := s.missingPrivileges(context.Background())
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				mt.Errorf("missingPrivileges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPrivilegesInsufficient(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("read only", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "authInfo", Value: bson.D{
+			{Key: "authenticatedUsers", Value: bson.A{bson.D{{Key: "user", Value: "reader"}}}},
+			{Key: "authenticatedUserPrivileges", Value: bson.A{bson.D{
+				{Key: "resource", Value: bson.D{{Key: "db", Value: mtest.TestDb}, {Key: "collection", Value: ""}}},
+				{Key: "actions", Value: bson.A{"find"}},
+			}}},
+		}}))
+		err := (&Service{database: mt.DB}).checkPrivileges(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "insert, update, createIndex, listCollections") {
+			mt.Errorf("checkPrivileges() = %v, want the missing privileges", err)
+		}
+	})
+	mt.Run("command fails", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "unauthorized"}))
+		if err := (&Service{database: mt.DB}).checkPrivileges(context.Background()); err == nil {
+			mt.Error("checkPrivileges() = nil, want the command's error")
+		}
+	})
+}
+
+func stringsToA(s []string) bson.A {
+	a := bson.A{}
+	for _, v := range s {
+		a = append(a, v)
+	}
+	return a
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	// Embeds the time zone database, as the worker image has none
+	_ "time/tzdata"
+)
+
+// errDailyQuotaReached is returned instead of making a youtube call that
+// would go over DAILY_QUOTA.
+var errDailyQuotaReached = errors.New("daily quota reached")
+
+// quotaZone is where youtube quotas reset at midnight.
+var quotaZone = mustLoadLocation("America/Los_Angeles")
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Fatalf("Unable to load time zone %s: %v", name, err)
+	}
+	return location
+}
+
+// nextQuotaReset returns the first midnight Pacific time after t.
+func nextQuotaReset(t time.Time) time.Time {
+	y, m, d := t.In(quotaZone).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, quotaZone)
+}
+
+// quotaTracker estimates the quota units used since youtube last reset it.
+// It only knows about the calls made since the worker started. A zero limit
+// never refuses a call.
+type quotaTracker struct {
+	limit   int
+	used    int
+	resetAt time.Time
+}
+
+// spend counts cost units at now, unless they would go over the limit.
+func (q *quotaTracker) spend(cost int, now time.Time) error {
+	if !now.Before(q.resetAt) {
+		q.used = 0
+		q.resetAt = nextQuotaReset(now)
+	}
+	if q.limit != 0 && q.used+cost > q.limit {
+		return fmt.Errorf("%w: %d of %d units used until %v", errDailyQuotaReached, q.used, q.limit, q.resetAt)
+	}
+	q.used += cost
+	return nil
+}
+
+// remaining returns the units left until the next reset after now.
+func (q *quotaTracker) remaining(now time.Time) int {
+	if !now.Before(q.resetAt) {
+		return q.limit
+	}
+	if q.used > q.limit {
+		return 0
+	}
+	return q.limit - q.used
+}
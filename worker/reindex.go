@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"example.com/hello/internal/model"
+	"example.com/hello/internal/mongoenv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// keywordCollections returns the names of all keyword collections, leaving
+// out internal ones.
+func (s *Service) keywordCollections(ctx context.Context) ([]string, error) {
+	collections, err := s.database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var keywords []string
+	for _, c := range collections {
+		if model.IsInternalCollection(c) {
+			continue
+		}
+		keywords = append(keywords, c)
+	}
+	return keywords, nil
+}
+
+// videoCollections returns the collections storing the videos of keywords,
+// or of every keyword when there are none. With STORAGE_MODE=shared that's
+// always the one shared collection.
+func (s *Service) videoCollections(ctx context.Context, keywords []string) []string {
+	if s.sharedStorage {
+		return []string{mongoenv.SharedCollection}
+	}
+	if len(keywords) == 0 {
+		collections, err := s.keywordCollections(ctx)
+		if err != nil {
+			log.Fatalf("Error: Unable get collections list: %v", err)
+		}
+		return collections
+	}
+	collections := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		collections[i] = s.collectionFor(ctx, keyword)
+	}
+	return collections
+}
+
+// reindex runs the reindex subcommand:
+//
+//	worker reindex [searchTerm...]
+//
+// It recreates the text index of the given keyword collections, or all of
+// them, so TEXT_INDEX_LANGUAGE changes apply to existing collections.
+func (s *Service) reindex(ctx context.Context, keywords []string) {
+	failed := false
+	for _, collection := range s.videoCollections(ctx, keywords) {
+		if err := s.recreateTextIndex(ctx, s.database.Collection(collection)); err != nil {
+			log.Printf("Error: Failed to reindex %s: %v", collection, err)
+			failed = true
+			continue
+		}
+		log.Printf("Reindexed %s", collection)
+	}
+	if failed {
+		log.Fatal("Reindex failed")
+	}
+}
+
+// recreateTextIndex replaces the collection's text index, as mongo only
+// allows one per collection.
+func (s *Service) recreateTextIndex(ctx context.Context, collection *mongo.Collection) error {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var indexes []struct {
+		Name string `bson:"name"`
+		Key  bson.M `bson:"key"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		// Text indexes are keyed on the internal _fts field
+		if _, ok := index.Key["_fts"]; !ok {
+			continue
+		}
+		if _, err := collection.Indexes().DropOne(ctx, index.Name); err != nil {
+			return err
+		}
+	}
+	_, err = collection.Indexes().CreateOne(ctx, s.textIndex())
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRecreateTextIndexLanguage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name         string
+		language     string
+		override     string
+		wantLanguage string
+		wantOverride string
+	}{
+		{"default english", "", "", "", ""},
+		{"spanish", "spanish", "", "spanish", ""},
+		{"no stemming", "none", "", "none", ""},
+		{"per document language", "french", "lang", "french", "lang"},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.Setenv("TEXT_INDEX_LANGUAGE", tt.language)
+			mt.Setenv("TEXT_INDEX_LANGUAGE_OVERRIDE", tt.override)
+			s := &Service{database: mt.DB}
+			s.loadOptions()
+
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "test.cats.$cmd.listIndexes", mtest.FirstBatch,
+					bson.D{{Key: "name", Value: "_id_"}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}},
+					bson.D{{Key: "name", Value: "title_text_description_text"}, {Key: "key", Value: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: 1}}}},
+				),
+				mtest.CreateSuccessResponse(),
+				mtest.CreateSuccessResponse(),
+			)
+			if err := s.recreateTextIndex(context.Background(), mt.DB.Collection("cats")); err != nil {
+				mt.Fatal(err)
+			}
+
+			var commands []string
+			for _, e := range mt.GetAllStartedEvents() {
+				commands = append(commands, e.CommandName)
+				switch e.CommandName {
+				case "dropIndexes":
+					if got := e.Command.Lookup("index").StringValue(); got != "title_text_description_text" {
+						mt.Errorf("dropped %s, want the text index", got)
+					}
+				case "createIndexes":
+					index := e.Command.Lookup("indexes").Array().Index(0).Value().Document()
+					language, _ := index.Lookup("default_language").StringValueOK()
+					override, _ := index.Lookup("language_override").StringValueOK()
+					if language != tt.wantLanguage || override != tt.wantOverride {
+						mt.Errorf("text index language %q, override %q, want %q, %q", language, override, tt.wantLanguage, tt.wantOverride)
+					}
+				}
+			}
+			if len(commands) != 3 || commands[1] != "dropIndexes" || commands[2] != "createIndexes" {
+				mt.Errorf("ran %v, want the text index dropped and created", commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// defaultRetryAttempts is how many times a youtube call is tried unless RETRY_ATTEMPTS is set
+	defaultRetryAttempts = 3
+	// defaultRetryDelay is the backoff before the first retry unless RETRY_DELAY is set
+	defaultRetryDelay = time.Second
+	// defaultRetryMaxDelay caps the backoff unless RETRY_MAX_DELAY is set
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// retryPolicy is how transient youtube API failures are retried.
+type retryPolicy struct {
+	attempts int
+	delay    time.Duration
+	maxDelay time.Duration
+}
+
+// backoff returns the jittered delay before retrying after the given failed
+// attempt: between half and all of delay doubled every attempt, up to maxDelay.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.delay
+	for i := 1; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isRetryable reports whether err is worth trying again: youtube failing on
+// its side or the network. Requests youtube rejects (bad request, quota
+// exceeded, ...) fail the same way every time.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// retry runs do until it succeeds, fails with an error that isn't retryable or
+// runs out of attempts, backing off between attempts. It gives up early with
+// the last error when ctx is done.
+func (s *Service) retry(ctx context.Context, do func() error) error {
+	policy := s.retryPolicy
+	if policy.attempts < 1 {
+		policy = retryPolicy{defaultRetryAttempts, defaultRetryDelay, defaultRetryMaxDelay}
+	}
+	for attempt := 1; ; attempt++ {
+		err := do()
+		if err == nil || attempt >= policy.attempts || !isRetryable(err) {
+			return err
+		}
+		delay := policy.backoff(attempt)
+		log.Printf("Warning: youtube call failed (attempt %d of %d), retrying in %v: %v", attempt, policy.attempts, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// runsCollection gets a runRecord when a one-shot run finishes, as a
+// completion marker for orchestrators chaining on the worker.
+const runsCollection = "_runs"
+
+type runRecord struct {
+	Mode      string    `bson:"mode"`
+	Keyword   string    `bson:"keyword"`
+	StartedAt time.Time `bson:"startedAt"`
+	EndedAt   time.Time `bson:"endedAt"`
+	Fetched   int       `bson:"fetched"`
+	Inserted  int       `bson:"inserted"`
+	Success   bool      `bson:"success"`
+	Error     string    `bson:"error,omitempty"`
+}
+
+// finishRun records run as finished with err and exits non-zero if it failed
+// or couldn't be recorded.
+func (s *Service) finishRun(ctx context.Context, run runRecord, err error) {
+	run, recordErr := s.recordRun(ctx, run, err)
+	if recordErr != nil {
+		log.Printf("Error: Unable to record run: %v", recordErr)
+		os.Exit(1)
+	}
+	log.Printf("Run finished, fetched %d and inserted %d videos", run.Fetched, run.Inserted)
+	if !run.Success {
+		os.Exit(1)
+	}
+}
+
+// recordRun stores run in runsCollection as finished now with err.
+func (s *Service) recordRun(ctx context.Context, run runRecord, err error) (runRecord, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	run.EndedAt = time.Now()
+	run.Success = err == nil
+	if err != nil {
+		run.Error = err.Error()
+	}
+	_, insertErr := s.database.Collection(runsCollection).InsertOne(ctx, run)
+	return run, insertErr
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRecordRun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name        string
+		err         error
+		wantSuccess bool
+		wantError   string
+	}{
+		{"completed", nil, true, ""},
+		{"failed", errors.New("quota exceeded"), false, "quota exceeded"},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			s := &Service{database: mt.DB}
+			started := time.Now().Add(-time.Minute)
+			run := runRecord{Mode: "once", Keyword: "cats", StartedAt: started, Fetched: 12, Inserted: 5}
+			if _, err := s.recordRun(context.Background(), run, tt.err); err != nil {
+				mt.Fatal(err)
+			}
+
+			e := mt.GetStartedEvent()
+			if e == nil || e.CommandName != "insert" || e.Command.Lookup("insert").StringValue() != runsCollection {
+				mt.Fatalf("ran %v, want an insert into %s", e, runsCollection)
+			}
+			marker := e.Command.Lookup("documents").Array().Index(0).Value().Document()
+			if marker.Lookup("keyword").StringValue() != "cats" || marker.Lookup("mode").StringValue() != "once" ||
+				marker.Lookup("fetched").AsInt64() != 12 || marker.Lookup("inserted").AsInt64() != 5 {
+				mt.Errorf("marker %v doesn't have the run's stats", marker)
+			}
+			if got := marker.Lookup("success").Boolean(); got != tt.wantSuccess {
+				mt.Errorf("success = %v, want %v", got, tt.wantSuccess)
+			}
+			if got, _ := marker.Lookup("error").StringValueOK(); got != tt.wantError {
+				mt.Errorf("error = %q, want %q", got, tt.wantError)
+			}
+			if ended := marker.Lookup("endedAt").Time(); ended.Before(started) {
+				mt.Errorf("endedAt %v before startedAt %v", ended, started)
+			}
+		})
+	}
+
+	mt.Run("not recorded", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "unauthorized"}))
+		if _, err := (&Service{database: mt.DB}).recordRun(context.Background(), runRecord{Keyword: "cats"}, nil); err == nil {
+			mt.Error("recordRun() = nil, want the insert's error")
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]searchConfig
+	}{
+		{"unset", "", map[string]searchConfig{}},
+		{"intervals", `{"news": 30}`, map[string]searchConfig{"news": {Interval: 30}}},
+		{
+			"objects",
+			`{"news": {"interval": 30, "maxResults": 10}, "cats": {"maxResults": 50}}`,
+			map[string]searchConfig{"news": {Interval: 30, MaxResults: 10}, "cats": {Interval: 60, MaxResults: 50}},
+		},
+		{
+			"mixed",
+			`{"news": 30, "cats": {"interval": 600, "maxResults": 1}}`,
+			map[string]searchConfig{"news": {Interval: 30}, "cats": {Interval: 600, MaxResults: 1}},
+		},
+		{"invalid interval", `{"news": 0}`, map[string]searchConfig{"news": {Interval: 60}}},
+		{"maxResults over 50", `{"news": {"interval": 30, "maxResults": 51}}`, map[string]searchConfig{"news": {Interval: 30}}},
+		{"negative maxResults", `{"news": {"interval": 30, "maxResults": -1}}`, map[string]searchConfig{"news": {Interval: 30}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SEARCH_CONFIG", tt.value)
+			if got := searchConfigFromEnv(60); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchConfigFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
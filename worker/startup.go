@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultStartupAttempts is how many times connecting at startup is tried unless STARTUP_ATTEMPTS is set
+	defaultStartupAttempts = 5
+	// defaultStartupDelay is the backoff before the first startup retry unless STARTUP_RETRY_DELAY is set
+	defaultStartupDelay = 2 * time.Second
+	// maxStartupDelay caps the backoff between startup retries
+	maxStartupDelay = time.Minute
+)
+
+// startupPolicyFromEnv returns how connecting at startup is retried, from
+// STARTUP_ATTEMPTS and STARTUP_RETRY_DELAY.
+func startupPolicyFromEnv() retryPolicy {
+	policy := retryPolicy{defaultStartupAttempts, defaultStartupDelay, maxStartupDelay}
+	if attempts := os.Getenv("STARTUP_ATTEMPTS"); attempts != "" {
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n < 1 {
+			log.Printf("STARTUP_ATTEMPTS must be at least 1. Defaulting to %d", defaultStartupAttempts)
+		} else {
+			policy.attempts = n
+		}
+	}
+	if delay := os.Getenv("STARTUP_RETRY_DELAY"); delay != "" {
+		n, err := strconv.Atoi(delay)
+		if err != nil || n < 0 {
+			log.Printf("STARTUP_RETRY_DELAY must be a number of seconds. Defaulting to %v", defaultStartupDelay)
+		} else {
+			policy.delay = time.Duration(n) * time.Second
+		}
+	}
+	return policy
+}
+
+// retryStartup runs do until it succeeds or policy runs out of attempts,
+// backing off between them, as dependencies started alongside the worker can
+// take a while to be ready. It gives up early with the last error when ctx
+// is done.
+func retryStartup(ctx context.Context, what string, policy retryPolicy, do func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := do()
+		if err == nil || attempt >= policy.attempts {
+			return err
+		}
+		delay := policy.backoff(attempt)
+		log.Printf("Warning: %s failed (attempt %d of %d), retrying in %v: %v", what, attempt, policy.attempts, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
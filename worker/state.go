@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultLookback is how far back the first ever poll of a search term goes.
+const defaultLookback = 24 * time.Hour
+
+type termState struct {
+	SearchTerm      string    `bson:"_id"`
+	LastFetchedTime time.Time `bson:"lastFetchedTime"`
+	// Seconds between polls, which ADAPTIVE_POLLING changes. Served on /status
+	PollInterval int `bson:"pollInterval,omitempty"`
+	// Of the last save, with RECORD_FETCH_TIMING=true. Served on /status
+	FetchTiming *model.FetchTimingStats `bson:"fetchTiming,omitempty"`
+}
+
+// lastFetchedTime returns the end of the last poll window saved for
+// searchTerm, or defaultLookback ago if there's none.
+func (s *Service) lastFetchedTime(ctx context.Context, searchTerm string) time.Time {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var state termState
+	err := s.database.Collection(model.StateCollection).FindOne(ctx, bson.D{{Key: "_id", Value: searchTerm}}).Decode(&state)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error: Unable to load state of %s: %v", searchTerm, err)
+		}
+		return s.now(ctx).Add(-defaultLookback)
+	}
+	log.Printf("Resuming %s from %v", searchTerm, state.LastFetchedTime)
+	return state.LastFetchedTime
+}
+
+// saveLastFetchedTime stores t as how far searchTerm has been collected.
+// Saves can finish out of order, so it never moves the time back.
+func (s *Service) saveLastFetchedTime(ctx context.Context, searchTerm string, t time.Time) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	_, err := s.database.Collection(model.StateCollection).UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: searchTerm}},
+		bson.D{{Key: "$max", Value: bson.D{{Key: "lastFetchedTime", Value: t}}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Error: Unable to save state of %s: %v", searchTerm, err)
+	}
+}
+
+// savePollInterval stores the current polling interval of searchTerm.
+func (s *Service) savePollInterval(ctx context.Context, searchTerm string, interval time.Duration) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	_, err := s.database.Collection(model.StateCollection).UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: searchTerm}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "pollInterval", Value: int(interval / time.Second)}}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Error: Unable to save polling interval of %s: %v", searchTerm, err)
+	}
+}
+
+// saveFetchTiming stores stats as the fetch timing of the last save of searchTerm.
+func (s *Service) saveFetchTiming(ctx context.Context, searchTerm string, stats model.FetchTimingStats) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	_, err := s.database.Collection(model.StateCollection).UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: searchTerm}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "fetchTiming", Value: stats}}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Error: Unable to save fetch timing of %s: %v", searchTerm, err)
+	}
+}
+
+// watermark is how far a search term has been collected: the end of the last
+// poll window whose videos were all stored, where the next window starts. It
+// only ever moves forward, as saves can finish out of order, and is shared by
+// the poll loop and the saves it starts.
+type watermark struct {
+	mu sync.Mutex
+	t  time.Time
+	// Stores the new watermark, so a restarted worker resumes from it
+	persist func(time.Time)
+}
+
+func (w *watermark) get() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.t
+}
+
+// advance moves the watermark to t, in memory and persisted alike, unless it's
+// already past it.
+func (w *watermark) advance(t time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !t.After(w.t) {
+		return
+	}
+	w.t = t
+	if w.persist != nil {
+		w.persist(t)
+	}
+}
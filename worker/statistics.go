@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"example.com/hello/internal/logging"
+	"example.com/hello/internal/model"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// videosQuotaCost is the quota units a videos.list call costs
+const videosQuotaCost = 1
+
+// addStatistics sets the view, like and comment counts of videos, looked up
+// searchPageSize ids per call, and marks them as enriched. Counts a channel
+// hides are left at zero. On failure the videos keep the counts they got so
+// far, and the rest stay unenriched.
+func (s *Service) addStatistics(ctx context.Context, videos []interface{}) {
+	calls := 0
+	for start := 0; start < len(videos); start += searchPageSize {
+		end := start + searchPageSize
+		if end > len(videos) {
+			end = len(videos)
+		}
+		index := map[string]int{}
+		var ids []string
+		for i := start; i < end; i++ {
+			video, _ := videos[i].(model.Video)
+			index[video.YoutubeID] = i
+			ids = append(ids, video.YoutubeID)
+		}
+
+		var response *youtube.VideoListResponse
+		started := time.Now()
+		err := s.withAPIKey(ctx, videosQuotaCost, func(client *youtube.Service) (err error) {
+			response, err = client.Videos.List([]string{"statistics"}).Id(ids...).MaxResults(searchPageSize).Context(ctx).Do()
+			return err
+		})
+		calls++
+		if err != nil {
+			log.Printf("Error: Unable to get statistics of %d videos: %v", len(ids), err)
+			break
+		}
+		setStatistics(videos, index, response.Items)
+		for i := start; i < end; i++ {
+			if video, _ := videos[i].(model.Video); video.Enriched && video.FetchTiming != nil {
+				video.FetchTiming.Enriched = true
+				video.FetchTiming.EnrichmentMs = time.Since(started).Milliseconds()
+			}
+		}
+	}
+	if calls != 0 {
+		logging.Info("fetched statistics", "count", len(videos), "calls", calls, "quota_units", calls*videosQuotaCost)
+	}
+}
+
+// setStatistics copies the statistics of items onto the videos at the index
+// of their id.
+func setStatistics(videos []interface{}, index map[string]int, items []*youtube.Video) {
+	for _, item := range items {
+		i, ok := index[item.Id]
+		if !ok || item.Statistics == nil {
+			continue
+		}
+		video, _ := videos[i].(model.Video)
+		video.ViewCount = int64(item.Statistics.ViewCount)
+		video.LikeCount = int64(item.Statistics.LikeCount)
+		video.CommentCount = int64(item.Statistics.CommentCount)
+		video.Enriched = true
+		videos[i] = video
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"example.com/hello/internal/model"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestSetStatistics(t *testing.T) {
+	videos := []interface{}{
+		model.Video{YoutubeID: "a"},
+		model.Video{YoutubeID: "b"},
+		model.Video{YoutubeID: "c"},
+	}
+	index := map[string]int{"a": 0, "b": 1, "c": 2}
+	items := []*youtube.Video{
+		{Id: "a", Statistics: &youtube.VideoStatistics{ViewCount: 100, LikeCount: 10, CommentCount: 1}},
+		// Listed without statistics
+		{Id: "b"},
+		// Not asked for
+		{Id: "z", Statistics: &youtube.VideoStatistics{ViewCount: 5}},
+	}
+	setStatistics(videos, index, items)
+
+	a := videos[0].(model.Video)
+	if !a.Enriched || a.ViewCount != 100 || a.LikeCount != 10 || a.CommentCount != 1 {
+		t.Errorf("a = %+v, want enriched with its statistics", a)
+	}
+	for _, v := range videos[1:] {
+		if video := v.(model.Video); video.Enriched || video.ViewCount != 0 {
+			t.Errorf("%s = %+v, want unenriched", video.YoutubeID, video)
+		}
+	}
+}
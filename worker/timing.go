@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	"example.com/hello/internal/model"
+)
+
+// fetchTimingStats aggregates the FetchTiming of videos, which they only have
+// with RECORD_FETCH_TIMING=true. ok is false when none has one.
+func fetchTimingStats(videos []interface{}, now time.Time) (stats model.FetchTimingStats, ok bool) {
+	var latency, enrichment int64
+	for _, v := range videos {
+		video, _ := v.(model.Video)
+		t := video.FetchTiming
+		if t == nil {
+			continue
+		}
+		stats.Videos++
+		latency += t.LatencyMs
+		if t.LatencyMs > stats.MaxLatencyMs {
+			stats.MaxLatencyMs = t.LatencyMs
+		}
+		if t.Enriched {
+			stats.EnrichedVideos++
+			enrichment += t.EnrichmentMs
+		}
+	}
+	if stats.Videos == 0 {
+		return stats, false
+	}
+	stats.AvgLatencyMs = latency / int64(stats.Videos)
+	if stats.EnrichedVideos != 0 {
+		stats.AvgEnrichmentMs = enrichment / int64(stats.EnrichedVideos)
+	}
+	stats.RecordedAt = now
+	return stats, true
+}
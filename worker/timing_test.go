@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFetchTimingStats(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		videos []interface{}
+		want   model.FetchTimingStats
+		wantOk bool
+	}{
+		{"none", nil, model.FetchTimingStats{}, false},
+		{"untimed", []interface{}{model.Video{YoutubeID: "a"}}, model.FetchTimingStats{}, false},
+		{
+			"mixed",
+			[]interface{}{
+				model.Video{YoutubeID: "a", FetchTiming: &model.FetchTiming{LatencyMs: 100, Enriched: true, EnrichmentMs: 40}},
+				model.Video{YoutubeID: "b", FetchTiming: &model.FetchTiming{LatencyMs: 300}},
+				model.Video{YoutubeID: "c"},
+				model.Video{YoutubeID: "d", FetchTiming: &model.FetchTiming{LatencyMs: 200, Enriched: true, EnrichmentMs: 60}},
+			},
+			model.FetchTimingStats{Videos: 3, AvgLatencyMs: 200, MaxLatencyMs: 300, EnrichedVideos: 2, AvgEnrichmentMs: 50, RecordedAt: now},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		got, ok := fetchTimingStats(tt.videos, now)
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("%s: fetchTimingStats = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestSaveStoresFetchTiming(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("timed", func(mt *mtest.T) {
+		s := &Service{database: mt.DB, insertBatchSize: 10}
+		s.existingCollections.Replace([]string{"cats"})
+		seenAt := time.Now().Add(-time.Second)
+		videos := []interface{}{
+			model.Video{YoutubeID: "dQw4w9WgXcQ", FetchTiming: &model.FetchTiming{SeenAt: seenAt, Enriched: true, EnrichmentMs: 20}},
+		}
+		// The bulk write, then the state update
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		s.save(context.Background(), "cats", videos, cycleMetrics{Keyword: "cats"})
+
+		var found bool
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName != "update" || e.Command.Lookup("update").StringValue() != model.StateCollection {
+				continue
+			}
+			found = true
+			update := e.Command.Lookup("updates").Array().Index(0).Value().Document()
+			if id := update.Lookup("q", "_id").StringValue(); id != "cats" {
+				mt.Errorf("updated the state of %q, want cats", id)
+			}
+			timing := update.Lookup("u", "$set", "fetchTiming").Document()
+			if n := timing.Lookup("videos").AsInt64(); n != 1 {
+				mt.Errorf("videos = %d, want 1", n)
+			}
+			if ms := timing.Lookup("avgLatencyMs").Int64(); ms < 1000 {
+				mt.Errorf("avgLatencyMs = %d, want at least the second since it was seen", ms)
+			}
+			if ms := timing.Lookup("avgEnrichmentMs").Int64(); ms != 20 {
+				mt.Errorf("avgEnrichmentMs = %d, want 20", ms)
+			}
+		}
+		if !found {
+			mt.Error("no fetch timing saved to the state")
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestVideoUpsert(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	video := model.Video{
+		YoutubeID:             "abc",
+		Title:                 "title",
+		ChannelID:             "channel",
+		DescriptionCompressed: true,
+		ViewCount:             10,
+	}
+	tests := []struct {
+		name     string
+		keyword  string
+		refresh  bool
+		wantOps  []string
+		inInsert []string
+		inSet    []string
+	}{
+		{
+			name:     "refresh",
+			refresh:  true,
+			wantOps:  []string{"$setOnInsert", "$set", "$unset"},
+			inInsert: []string{"youtubeId", "channelId", "firstSeenAt"},
+			inSet:    []string{"title", "viewCount", "descriptionCompressed"},
+		},
+		{
+			name:     "insert only",
+			wantOps:  []string{"$setOnInsert"},
+			inInsert: []string{"youtubeId", "channelId", "firstSeenAt", "title", "viewCount"},
+		},
+		{
+			name:     "insert only with keyword",
+			keyword:  "cats",
+			wantOps:  []string{"$setOnInsert", "$addToSet"},
+			inInsert: []string{"youtubeId", "title"},
+		},
+		{
+			name:    "refresh with keyword",
+			keyword: "cats",
+			refresh: true,
+			wantOps: []string{"$setOnInsert", "$set", "$unset", "$addToSet"},
+			inSet:   []string{"title"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := videoUpsert(video, tt.keyword, tt.refresh, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			upsert := m.(*mongo.UpdateOneModel)
+			if *upsert.Upsert != true {
+				t.Error("should upsert")
+			}
+			if filter := upsert.Filter.(bson.M); filter["youtubeId"] != "abc" {
+				t.Errorf("filter = %v", filter)
+			}
+			update := upsert.Update.(bson.M)
+			if len(update) != len(tt.wantOps) {
+				t.Errorf("update = %v, want operators %v", update, tt.wantOps)
+			}
+			for _, op := range tt.wantOps {
+				if _, ok := update[op]; !ok {
+					t.Errorf("update misses %s: %v", op, update)
+				}
+			}
+			onInsert := update["$setOnInsert"].(bson.M)
+			set, _ := update["$set"].(bson.M)
+			for _, field := range tt.inInsert {
+				if _, ok := onInsert[field]; !ok {
+					t.Errorf("$setOnInsert misses %s", field)
+				}
+			}
+			for _, field := range tt.inSet {
+				if _, ok := set[field]; !ok {
+					t.Errorf("$set misses %s", field)
+				}
+				if _, ok := onInsert[field]; ok {
+					t.Errorf("%s is in both $set and $setOnInsert", field)
+				}
+			}
+			if onInsert["firstSeenAt"] != now {
+				t.Errorf("firstSeenAt = %v, want %v", onInsert["firstSeenAt"], now)
+			}
+			if tt.keyword != "" {
+				if got := update["$addToSet"].(bson.M)["keywords"]; got != tt.keyword {
+					t.Errorf("$addToSet keywords = %v, want %s", got, tt.keyword)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveVideosToDBPartialFailure(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	upserted := func(n int) bson.D {
+		var ids bson.A
+		for i := 0; i < n; i++ {
+			ids = append(ids, bson.D{{Key: "index", Value: i}, {Key: "_id", Value: primitive.NewObjectID()}})
+		}
+		return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: 0}, bson.E{Key: "upserted", Value: ids})
+	}
+	failed := mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "not authorized to insert"})
+	tests := []struct {
+		name         string
+		responses    []bson.D
+		wantInserted int
+		wantErr      string
+	}{
+		{"all chunks stored", []bson.D{upserted(2), upserted(2), upserted(1)}, 5, ""},
+		{"middle chunk fails", []bson.D{upserted(2), failed, upserted(1)}, 3, "1 of 3 chunks failed"},
+		{"first and last fail", []bson.D{failed, upserted(2), failed}, 2, "2 of 3 chunks failed"},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := &Service{database: mt.DB, insertBatchSize: 2, updateMutableFields: true}
+			s.existingCollections.Replace([]string{"cats"})
+			var videos []interface{}
+			for _, id := range []string{"video000001", "video000002", "video000003", "video000004", "video000005"} {
+				videos = append(videos, model.Video{YoutubeID: id})
+			}
+			mt.AddMockResponses(tt.responses...)
+
+			inserted, _, err := s.saveVideosToDB(context.Background(), "cats", videos)
+			if inserted != tt.wantInserted {
+				mt.Errorf("inserted %d, want %d", inserted, tt.wantInserted)
+			}
+			if tt.wantErr == "" && err != nil {
+				mt.Errorf("saveVideosToDB() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				mt.Errorf("saveVideosToDB() error = %v, want %q", err, tt.wantErr)
+			}
+			if n := len(mt.GetAllStartedEvents()); n != 3 {
+				mt.Errorf("sent %d writes, want a write per chunk", n)
+			}
+		})
+	}
+}
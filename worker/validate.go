@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"example.com/hello/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errSkipped is returned by checks that can't run because an earlier one failed.
+var errSkipped = errors.New("skipped")
+
+// check is a step of validate.
+type check struct {
+	name string
+	run  func() error
+	// The checks after a failed required one aren't run
+	required bool
+}
+
+// runChecks runs checks in order, writing a pass/fail line for each to w, and
+// reports whether they all passed.
+func runChecks(w io.Writer, checks []check) bool {
+	ok := true
+	for _, c := range checks {
+		err := c.run()
+		switch {
+		case errors.Is(err, errSkipped):
+			ok = false
+			fmt.Fprintf(w, "SKIP  %s\n", c.name)
+			continue
+		case err != nil:
+			ok = false
+			fmt.Fprintf(w, "FAIL  %s: %v\n", c.name, err)
+			if c.required {
+				return false
+			}
+			continue
+		}
+		fmt.Fprintf(w, "PASS  %s\n", c.name)
+	}
+	return ok
+}
+
+// validate checks that the worker is able to run without starting collection:
+// every API key can search youtube, and the database is reachable, writable and
+// can be indexed. It prints a pass/fail report and returns false on any failure.
+func validate(ctx context.Context, keys []string, mongoUri, mongoDbName string) bool {
+	var checks []check
+	for _, key := range keys {
+		key := key
+		name := "youtube search"
+		if len(keys) > 1 {
+			name = fmt.Sprintf("youtube search with key %s", (&apiKey{key: key}).label())
+		}
+		checks = append(checks, check{name: name, run: func() error {
+			youtubeClient, err := newYoutubeClient(key)
+			if err == nil {
+				_, err = youtubeClient.Search.List([]string{"id"}).Q("youtube").Type("video").MaxResults(1).Do()
+			}
+			return err
+		}})
+	}
+
+	var mongoClient *mongo.Client
+	var collection *mongo.Collection
+	var insertedID interface{}
+	checks = append(checks,
+		check{name: "mongo connection", required: true, run: func() error {
+			var err error
+			mongoClient, err = connectDatabase(ctx, mongoUri)
+			if err != nil {
+				return err
+			}
+			// Use a throwaway collection so existing keyword collections are untouched
+			collection = mongoClient.Database(mongoDbName).Collection(fmt.Sprintf("_validate_%d", time.Now().UnixNano()))
+			return nil
+		}},
+		check{name: "mongo write", run: func() error {
+			res, err := collection.InsertOne(ctx, model.Video{YoutubeID: "validate", Title: "validate"})
+			if err == nil {
+				insertedID = res.InsertedID
+			}
+			return err
+		}},
+		check{name: "mongo delete", run: func() error {
+			if insertedID == nil {
+				return errSkipped
+			}
+			_, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: insertedID}})
+			return err
+		}},
+		check{name: "index creation", run: func() error {
+			s := &Service{}
+			s.loadOptions()
+			_, err := collection.Indexes().CreateMany(ctx, s.videoIndexes())
+			return err
+		}},
+	)
+	ok := runChecks(os.Stdout, checks)
+	if mongoClient != nil {
+		collection.Drop(ctx)
+		mongoClient.Disconnect(ctx)
+	}
+
+	if ok {
+		fmt.Println("Validation passed")
+	} else {
+		fmt.Println("Validation failed")
+	}
+	return ok
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRunChecks(t *testing.T) {
+	pass := func() error { return nil }
+	fail := func() error { return errors.New("unauthorized") }
+	skip := func() error { return errSkipped }
+	tests := []struct {
+		name   string
+		checks []check
+		want   bool
+		output string
+	}{
+		{
+			"happy path",
+			[]check{{name: "youtube search", run: pass}, {name: "mongo connection", run: pass, required: true}, {name: "mongo write", run: pass}},
+			true,
+			"PASS  youtube search\nPASS  mongo connection\nPASS  mongo write\n",
+		},
+		{
+			"failure keeps checking",
+			[]check{{name: "youtube search", run: fail}, {name: "mongo connection", run: pass, required: true}},
+			false,
+			"FAIL  youtube search: unauthorized\nPASS  mongo connection\n",
+		},
+		{
+			"required failure stops",
+			[]check{{name: "mongo connection", run: fail, required: true}, {name: "mongo write", run: pass}},
+			false,
+			"FAIL  mongo connection: unauthorized\n",
+		},
+		{
+			"skipped check fails",
+			[]check{{name: "mongo write", run: fail}, {name: "mongo delete", run: skip}, {name: "index creation", run: pass}},
+			false,
+			"FAIL  mongo write: unauthorized\nSKIP  mongo delete\nPASS  index creation\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if got := runChecks(&out, tt.checks); got != tt.want {
+				t.Errorf("runChecks() = %v, want %v", got, tt.want)
+			}
+			if out.String() != tt.output {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), tt.output)
+			}
+		})
+	}
+}